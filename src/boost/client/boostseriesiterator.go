@@ -1,9 +1,10 @@
 package client
 
 import (
-	"encoding/binary"
+	"fmt"
 
 	"github.com/m3db/m3/src/boost/core"
+	"github.com/m3db/m3/src/boost/core/annotation"
 	"github.com/m3db/m3/src/dbnode/encoding"
 	"github.com/m3db/m3/src/dbnode/ts"
 	"github.com/m3db/m3/src/x/ident"
@@ -17,14 +18,48 @@ type SymTableFetchFunction func(
 	timeBegin xtime.UnixNano,
 	timeEnd xtime.UnixNano) (*core.SymTable, error)
 
+// SymTableIncrementalFetchFunction fetches just the operations a peer is
+// missing from a symbol table (everything recorded after fromOpSeqNum),
+// plus the content hash the table should have once they're all applied, so
+// BoostSeriesIterator.Attributes can catch a stale cached copy up via
+// SymTable.Iterator/Apply instead of refetching the whole table. See
+// NewBoostSeriesIteratorWithIncrementalFetch.
+type SymTableIncrementalFetchFunction func(
+	namespaceId ident.ID,
+	symTableName string,
+	fromOpSeqNum uint32,
+	timeBegin xtime.UnixNano,
+	timeEnd xtime.UnixNano) (*core.SymTableOpIterator, uint64, error)
+
+// c_MaxIncrementalVersionDelta bounds how far the annotation's symtable
+// version may run ahead of what bsi.symTable was last synced to before
+// Attributes gives up on an incremental catch-up and falls back to a full
+// fetch.
+const c_MaxIncrementalVersionDelta = 4
+
 type BoostSeriesIterator struct {
-	seriesIter      encoding.SeriesIterator
-	symTableFetchFn SymTableFetchFunction
-	symTable        *core.SymTable
-	startTime       xtime.UnixNano
-	endTime         xtime.UnixNano
-	annotation      ts.Annotation
-	attributeIter   ident.TagIterator
+	seriesIter                 encoding.SeriesIterator
+	symTableFetchFn            SymTableFetchFunction
+	symTableIncrementalFetchFn SymTableIncrementalFetchFunction
+	symTable                   *core.SymTable
+
+	// symTableVersion is the annotation version bsi.symTable currently
+	// reflects. It starts out equal to symTable.Version() (the generation
+	// the table was fetched at), but once an incremental catch-up has been
+	// applied on top, it can run ahead of symTable.Version() - which stays
+	// pinned to the table's originating generation - so this field, not
+	// symTable.Version(), is what Attributes checks for staleness.
+	symTableVersion uint16
+
+	startTime     xtime.UnixNano
+	endTime       xtime.UnixNano
+	annotation    ts.Annotation
+	attributeIter ident.TagIterator
+
+	// decodeErr holds the first annotation decode/corruption error
+	// encountered by Attributes, surfaced through Err() rather than
+	// panicking or silently returning no attributes.
+	decodeErr error
 }
 
 // NewBoostSeriesIterator returns a new series iterator
@@ -44,10 +79,32 @@ func NewBoostSeriesIterator(
 	}
 }
 
+// NewBoostSeriesIteratorWithIncrementalFetch is like NewBoostSeriesIterator,
+// but additionally takes a SymTableIncrementalFetchFunction: Attributes
+// will prefer catching a stale cached symbol table up via
+// SymTable.Iterator/Apply over refetching it whole, as long as the version
+// gap is small and the resulting content hash checks out. A version bump
+// in this wire format marks a new table generation rather than an
+// incremental op count, so incrementalFetchFn is only useful paired with a
+// source that understands how to bridge generations (e.g. a future
+// snapshot-chain-aware store); ordinary callers should keep using
+// NewBoostSeriesIterator, which leaves this nil and always fetches in full.
+func NewBoostSeriesIteratorWithIncrementalFetch(
+	seriesIter encoding.SeriesIterator,
+	symTableFetchFn SymTableFetchFunction,
+	incrementalFetchFn SymTableIncrementalFetchFunction,
+	startTime xtime.UnixNano,
+	endTime xtime.UnixNano) *BoostSeriesIterator {
+	bsi := NewBoostSeriesIterator(seriesIter, symTableFetchFn, startTime, endTime)
+	bsi.symTableIncrementalFetchFn = incrementalFetchFn
+	return bsi
+}
+
 // Moves to the next item
 func (bsi *BoostSeriesIterator) Next() bool {
 	bsi.attributeIter = nil
 	bsi.annotation = nil
+	bsi.decodeErr = nil
 	return bsi.seriesIter.Next()
 }
 
@@ -60,8 +117,12 @@ func (bsi *BoostSeriesIterator) Current() (
 	return dp, t, nil
 }
 
-// Err returns any errors encountered
+// Err returns any errors encountered, including a failure to decode or
+// verify the current datapoint's annotation.
 func (bsi *BoostSeriesIterator) Err() error {
+	if bsi.decodeErr != nil {
+		return bsi.decodeErr
+	}
 	return bsi.seriesIter.Err()
 }
 
@@ -93,30 +154,13 @@ func (bsi *BoostSeriesIterator) Attributes() ident.TagIterator {
 		return bsi.attributeIter
 	}
 
-	// First 2 bytes the version of the symtable
-	version := binary.LittleEndian.Uint16(bsi.annotation)
-	if (bsi.symTable == nil) || (bsi.symTable.Version() != version) {
-		symTableName := "m3_symboltable_" + bsi.ID().String()
-		symTable, err := bsi.symTableFetchFn(
-			bsi.Namespace(),
-			symTableName,
-			version,
-			bsi.startTime,
-			bsi.endTime)
-		if err != nil {
-			return nil
-		}
-		bsi.symTable = symTable
+	header, symTable, err := bsi.IndexedHeader()
+	if err != nil {
+		bsi.decodeErr = err
+		return nil
 	}
 
-	indexedHeaderSz := int(binary.LittleEndian.Uint16(bsi.annotation[2:]))
-	indexedHeader := make([]int, indexedHeaderSz)
-	tmp := bsi.annotation[4:]
-	for i := range indexedHeader {
-		indexedHeader[i] = int(binary.LittleEndian.Uint32(tmp[i*4:]))
-	}
-
-	attributeMap := bsi.symTable.GetAttributesFromIndexedHeader(indexedHeader)
+	attributeMap := symTable.GetAttributesFromIndexedHeader(header)
 	attrTags := make([]ident.Tag, len(attributeMap))
 	ndx := 0
 	for name, value := range attributeMap {
@@ -126,3 +170,84 @@ func (bsi *BoostSeriesIterator) Attributes() ident.TagIterator {
 	bsi.attributeIter = ident.NewTagsIterator(ident.NewTags(attrTags...))
 	return bsi.attributeIter
 }
+
+// IndexedHeader decodes the current datapoint's annotation and resolves
+// bsi.symTable to the generation it was encoded against - the same work
+// Attributes does - but returns the raw indexed header and resolved
+// SymTable instead of materializing a full attribute map. This lets a
+// caller that only needs to test a predicate (e.g.
+// M3DBSeriesFamilyIterator.Next, via SymTable.ResolvePredicateMask) or
+// read a single numeric column skip the per-row string reconstruction
+// Attributes otherwise pays unconditionally, and only materialize once a
+// row actually matches.
+func (bsi *BoostSeriesIterator) IndexedHeader() ([]int, *core.SymTable, error) {
+	decoded, err := annotation.Decode(bsi.annotation)
+	if err != nil {
+		return nil, nil, fmt.Errorf("boostseriesiterator: decode annotation: %w", err)
+	}
+	version := decoded.SymTableVersion
+
+	if bsi.symTable == nil || bsi.symTableVersion != version {
+		symTableName := "m3_symboltable_" + bsi.ID().String()
+
+		caughtUp := false
+		if bsi.symTable != nil && bsi.symTableIncrementalFetchFn != nil &&
+			version > bsi.symTableVersion && version-bsi.symTableVersion <= c_MaxIncrementalVersionDelta {
+			caughtUp = bsi.tryIncrementalCatchUp(symTableName, version)
+		}
+
+		if !caughtUp {
+			symTable, err := bsi.symTableFetchFn(
+				bsi.Namespace(),
+				symTableName,
+				version,
+				bsi.startTime,
+				bsi.endTime)
+			if err != nil {
+				return nil, nil, err
+			}
+			// decoded.SymTableHash is absent (zero) only when the
+			// annotation predates this field (legacy layout); otherwise
+			// a mismatch means the fetched table has diverged from the
+			// one this datapoint was encoded against.
+			if decoded.SymTableHash != 0 && symTable.ContentHash() != decoded.SymTableHash {
+				return nil, nil, fmt.Errorf(
+					"boostseriesiterator: symtable %q content hash mismatch: want %x got %x",
+					symTableName, decoded.SymTableHash, symTable.ContentHash())
+			}
+			bsi.symTable = symTable
+			bsi.symTableVersion = version
+		}
+	}
+
+	return decoded.IndexedHeader, bsi.symTable, nil
+}
+
+// tryIncrementalCatchUp attempts to bring bsi.symTable up to toVersion by
+// replaying just the operations it's missing (via SymTable.Iterator/Apply)
+// instead of refetching the whole table. Returns false - leaving
+// bsi.symTable untouched - on any fetch/apply error or if the resulting
+// ContentHash doesn't match what the source reports, in which case the
+// caller falls back to a full fetch.
+func (bsi *BoostSeriesIterator) tryIncrementalCatchUp(symTableName string, toVersion uint16) bool {
+	it, expectedHash, err := bsi.symTableIncrementalFetchFn(
+		bsi.Namespace(),
+		symTableName,
+		bsi.symTable.OpSeqNum(),
+		bsi.startTime,
+		bsi.endTime)
+	if err != nil || it == nil {
+		return false
+	}
+
+	if err := bsi.symTable.Apply(it); err != nil {
+		return false
+	}
+
+	if bsi.symTable.ContentHash() != expectedHash {
+		return false
+	}
+
+	bsi.symTableVersion = toVersion
+	return true
+}
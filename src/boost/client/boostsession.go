@@ -1,28 +1,98 @@
 package client
 
 import (
+	"bytes"
 	gocontext "context"
-	"encoding/binary"
+	"encoding/gob"
 	"errors"
 	"sync"
 
 	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/m3db/m3/src/boost/core"
+	"github.com/m3db/m3/src/boost/core/annotation"
 	"github.com/m3db/m3/src/dbnode/client"
 	"github.com/m3db/m3/src/dbnode/encoding"
 	"github.com/m3db/m3/src/dbnode/storage/index"
 	"github.com/m3db/m3/src/x/ident"
+	"github.com/uber-go/tally"
 
 	xtime "github.com/m3db/m3/src/x/time"
 )
 
+// symTableEntry wraps a single data series' *core.SymTable with its own
+// lock, so a slow hydration or dictionary update on one series doesn't
+// block writes or fetches against any other series. bs.cacheMu only ever
+// guards the LRU's own get/put bookkeeping - the entry's mu is what
+// protects the symTable field and its contents, and it's held for the
+// whole header-index/dictionary critical section by callers.
+//
+// lastEndTime/lastSeqNum record the watermark of the most recent successful
+// hydration of symTable, so a later fetchOrCreateSymTable call for an
+// overlapping range can apply just the new instructions past that
+// watermark instead of replaying the stream from its InitSymTable. See
+// readSymTableStreamIncremental.
+type symTableEntry struct {
+	mu          sync.Mutex
+	symTable    *core.SymTable
+	lastEndTime xtime.UnixNano
+	lastSeqNum  uint32
+}
+
+// SymTableRecoveryPolicy controls how readSymTableStream responds to a
+// sequence-number gap in the underlying instruction stream - e.g. a torn
+// write, where a prior writer crashed partway through a symbol table
+// update - while hydrating a symbol table.
+type SymTableRecoveryPolicy int
+
+const (
+	// SymTableRecoveryStrict fails with an error on the first sequence
+	// number gap it finds. This is the zero value, so a BoostSession
+	// constructed without specifying a policy gets this behavior.
+	SymTableRecoveryStrict SymTableRecoveryPolicy = iota
+
+	// SymTableRecoverySkipGaps tolerates a single gap: it scans forward
+	// for the next InitSymTable instruction carrying the requested
+	// version and resumes hydration from there instead of returning an
+	// error. A second gap found after that recovery is still an error.
+	SymTableRecoverySkipGaps
+
+	// SymTableRecoveryLatestValid is like SymTableRecoverySkipGaps, but
+	// keeps recovering through every gap it encounters, so the symTable
+	// it returns always reflects the most recent complete generation
+	// found in the scanned range.
+	SymTableRecoveryLatestValid
+)
+
 type BoostSession struct {
-	session             client.Session
-	maxSymTables        int
-	symTables           *lru.Cache[string, *core.SymTable]
-	numSymbolUpdates    uint64
-	numAttributeUpdates uint64
-	rwControl           sync.Mutex
+	session      client.Session
+	maxSymTables int
+	symTables    *lru.Cache[string, *symTableEntry]
+
+	// cacheMu protects only symTables' get/put bookkeeping - a short
+	// critical section - not the symbol tables themselves. See
+	// symTableEntry and getOrCreateEntry.
+	cacheMu sync.Mutex
+
+	// Optional embedded cache shared by every BoostSession on the host, so
+	// that a cold LRU (e.g. right after process start) doesn't have to
+	// rescan a symbol table stream from the beginning. See
+	// NewBoostSessionWithSymTableCache.
+	symTableCache SymTableCache
+
+	// scope reports counters for writes, fetches and symbol table
+	// maintenance. Defaults to tally.NoopScope so call sites never need a
+	// nil check; see NewBoostSessionWithScope to wire up a real one.
+	scope tally.Scope
+
+	// recoveryPolicy governs how readSymTableStream reacts to a sequence
+	// number gap while hydrating a symbol table. Defaults to
+	// SymTableRecoveryStrict; see NewBoostSessionWithRecoveryPolicy.
+	recoveryPolicy SymTableRecoveryPolicy
+
+	// newSymStreamReader builds the core.SymStreamReader readSymTableStream
+	// scans. Defaulted in NewBoostSession to wrap core.NewM3DBSymStreamReader;
+	// tests in this package override it directly with a fake reader.
+	newSymStreamReader func(namespace, streamId ident.ID) core.SymStreamReader
 }
 
 // NewBoostSession returns a new session that can be used to write to the database.
@@ -30,14 +100,15 @@ func NewBoostSession(
 	session client.Session,
 	maxSymTables int) *BoostSession {
 	bs := &BoostSession{
-		session:             session,
-		maxSymTables:        maxSymTables,
-		numSymbolUpdates:    0,
-		numAttributeUpdates: 0,
-		rwControl:           sync.Mutex{},
+		session:      session,
+		maxSymTables: maxSymTables,
+		scope:        tally.NoopScope,
+	}
+	bs.newSymStreamReader = func(namespace, streamId ident.ID) core.SymStreamReader {
+		return core.NewM3DBSymStreamReader(namespace, streamId, bs.session)
 	}
 
-	cache, err := lru.New[string, *core.SymTable](maxSymTables)
+	cache, err := lru.New[string, *symTableEntry](maxSymTables)
 	if err != nil {
 		return nil
 	}
@@ -45,6 +116,67 @@ func NewBoostSession(
 	return bs
 }
 
+// NewBoostSessionWithRecoveryPolicy is like NewBoostSession, but additionally
+// sets the policy readSymTableStream uses to recover from a sequence number
+// gap while hydrating a symbol table, instead of the default
+// SymTableRecoveryStrict.
+func NewBoostSessionWithRecoveryPolicy(
+	session client.Session,
+	maxSymTables int,
+	recoveryPolicy SymTableRecoveryPolicy) *BoostSession {
+	bs := NewBoostSession(session, maxSymTables)
+	if bs != nil {
+		bs.recoveryPolicy = recoveryPolicy
+	}
+	return bs
+}
+
+// NewBoostSessionWithScope is like NewBoostSession, but additionally
+// reports write/fetch/symbol-table counters to scope (e.g. a tally scope
+// wired up to Prometheus), instead of the default no-op scope.
+func NewBoostSessionWithScope(
+	session client.Session,
+	maxSymTables int,
+	scope tally.Scope) *BoostSession {
+	bs := NewBoostSession(session, maxSymTables)
+	if bs != nil {
+		bs.scope = scope
+	}
+	return bs
+}
+
+// getOrCreateEntry returns the symTableEntry for symTableName, creating and
+// adding an empty one to the LRU if it doesn't already exist. The returned
+// entry's symTable field may still be nil (never hydrated/created) - callers
+// must take entry.mu before reading or populating it.
+func (bs *BoostSession) getOrCreateEntry(symTableName string) *symTableEntry {
+	bs.cacheMu.Lock()
+	defer bs.cacheMu.Unlock()
+
+	entry, ok := bs.symTables.Get(symTableName)
+	if !ok {
+		entry = &symTableEntry{}
+		bs.symTables.Add(symTableName, entry)
+	}
+	return entry
+}
+
+// NewBoostSessionWithSymTableCache is like NewBoostSession, but additionally
+// threads a shared SymTableCache through fetchOrCreateSymTable so that
+// concurrent readers for the same symbol table - even across process
+// restarts - hydrate from the cached snapshot and only scan the tail of the
+// stream, rather than rescanning it in full.
+func NewBoostSessionWithSymTableCache(
+	session client.Session,
+	maxSymTables int,
+	symTableCache SymTableCache) *BoostSession {
+	bs := NewBoostSession(session, maxSymTables)
+	if bs != nil {
+		bs.symTableCache = symTableCache
+	}
+	return bs
+}
+
 // WriteClusterAvailability returns whether cluster is available for writes.
 func (bs *BoostSession) WriteClusterAvailability() (bool, error) {
 	return bs.session.WriteClusterAvailability()
@@ -92,20 +224,24 @@ func (bs *BoostSession) WriteValueWithTaggedAttributes(
 	completionFn core.TAPWriteCompletionFn,
 ) error {
 
-	// Check if the symbol table exists for this data series. This is done
-	// under a lock
-	bs.rwControl.Lock()
-
+	// Find (or create) this data series' symTableEntry. Only the LRU's own
+	// get/put bookkeeping is done under bs.cacheMu, in getOrCreateEntry - everything that
+	// follows is serialized solely against other writers/readers of this
+	// one series, via entry.mu.
 	dataSeriesId := id.String()
 	symTableName := "m3_symboltable_" + dataSeriesId
-	symTable, ok := bs.symTables.Get(symTableName)
-	if !ok {
+	entry := bs.getOrCreateEntry(symTableName)
+
+	entry.mu.Lock()
+
+	symTable := entry.symTable
+	if symTable == nil {
 		m3dbStreamWriter := core.NewM3DBSymStreamWriter(
 			namespace,
 			ident.StringID(symTableName),
 			bs.session)
 		symTable = core.NewSymTable(symTableName, 1, m3dbStreamWriter)
-		bs.symTables.Add(symTableName, symTable)
+		entry.symTable = symTable
 	}
 
 	attrMap := make(map[string]string)
@@ -120,20 +256,18 @@ func (bs *BoostSession) WriteValueWithTaggedAttributes(
 		bs.updateSymbolsAndAttributes(symTable, attrMap)
 		indexedHeader, hasMissing = symTable.GetIndexedHeader(attrMap)
 		if hasMissing {
-			bs.rwControl.Unlock()
+			entry.mu.Unlock()
 			return errors.New("unable to find all attributes in the symbol table")
 		}
 	}
 
-	annotation := make([]byte, 4+(4*len(indexedHeader)))
-	binary.LittleEndian.PutUint16(annotation, symTable.Version())
-	binary.LittleEndian.PutUint16(annotation[2:], uint16(len(indexedHeader)))
-	tmp := annotation[4:]
-	for i, index := range indexedHeader {
-		binary.LittleEndian.PutUint32(tmp[i*4:], uint32(index))
-	}
-	// Unlock the mutex
-	bs.rwControl.Unlock()
+	encodedAnnotation := annotation.Encode(annotation.Annotation{
+		SymTableVersion: symTable.Version(),
+		SymTableHash:    symTable.ContentHash(),
+		IndexedHeader:   indexedHeader,
+	}, annotation.EncodeOptions{})
+	// Unlock the per-series lock - the write itself doesn't touch symTable.
+	entry.mu.Unlock()
 
 	go func(
 		namespace,
@@ -143,13 +277,226 @@ func (bs *BoostSession) WriteValueWithTaggedAttributes(
 		value float64,
 		unit xtime.Unit,
 		completionFn core.TAPWriteCompletionFn) {
-		ret := bs.session.WriteTagged(namespace, id, tags, t, value, unit, annotation)
+		ret := bs.session.WriteTagged(namespace, id, tags, t, value, unit, encodedAnnotation)
+		if ret != nil {
+			bs.scope.Counter("writes_error").Inc(1)
+		} else {
+			bs.scope.Counter("writes_success").Inc(1)
+		}
 		completionFn(ret)
 	}(namespace, id, tags.Duplicate(), t, value, unit, completionFn)
 
 	return nil
 }
 
+// c_WriteBatchMaxConcurrency bounds how many underlying session.WriteTagged
+// calls WriteBatchWithTaggedAttributes has in flight at once, since
+// client.Session doesn't expose a batched write call this can issue
+// instead.
+const c_WriteBatchMaxConcurrency = 32
+
+// TAPWrite is a single datapoint submitted to WriteBatchWithTaggedAttributes.
+type TAPWrite struct {
+	ID         ident.ID
+	Tags       ident.TagIterator
+	Attributes ident.TagIterator
+	T          xtime.UnixNano
+	Value      float64
+	Unit       xtime.Unit
+}
+
+// WriteBatchWithTaggedAttributes writes a batch of datapoints, amortizing
+// the per-series symbol table lookup and annotation construction that
+// WriteValueWithTaggedAttributes otherwise pays once per sample. Writes are
+// grouped by data series so each series' symTableEntry lock is taken once
+// for the whole group, covering updateSymbolsAndAttributes for the union of
+// values the group is missing and the GetIndexedHeader call for every
+// sample in it. completionFn is invoked exactly once, with one result per
+// write in the same order writes were given.
+//
+// client.Session doesn't expose a batched write call, so the underlying
+// session.WriteTagged calls are issued from a bounded pool of goroutines
+// instead of one unbounded fan-out.
+func (bs *BoostSession) WriteBatchWithTaggedAttributes(
+	namespace ident.ID,
+	writes []TAPWrite,
+	completionFn func(results []error)) error {
+
+	if len(writes) == 0 {
+		completionFn(nil)
+		return nil
+	}
+
+	results := make([]error, len(writes))
+	encodedAnnotations := make([][]byte, len(writes))
+
+	groupOrder, groupIndices := groupTAPWritesBySeries(writes)
+
+	var groupWg sync.WaitGroup
+	for _, symTableName := range groupOrder {
+		groupWg.Add(1)
+		go func(symTableName string, indices []int) {
+			defer groupWg.Done()
+			bs.encodeWriteBatchGroup(namespace, symTableName, writes, indices, encodedAnnotations, results)
+		}(symTableName, groupIndices[symTableName])
+	}
+	groupWg.Wait()
+
+	sem := make(chan struct{}, c_WriteBatchMaxConcurrency)
+	var writeWg sync.WaitGroup
+	for i := range writes {
+		if results[i] != nil {
+			// Already failed to resolve its attributes - nothing to write.
+			continue
+		}
+		writeWg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer writeWg.Done()
+			defer func() { <-sem }()
+			w := writes[i]
+			results[i] = bs.session.WriteTagged(
+				namespace, w.ID, w.Tags, w.T, w.Value, w.Unit, encodedAnnotations[i])
+		}(i)
+	}
+	writeWg.Wait()
+
+	var succeeded, failed int64
+	for _, err := range results {
+		if err != nil {
+			failed++
+		} else {
+			succeeded++
+		}
+	}
+	bs.scope.Counter("writes_success").Inc(succeeded)
+	bs.scope.Counter("writes_error").Inc(failed)
+
+	completionFn(results)
+	return nil
+}
+
+// groupTAPWritesBySeries returns, for each distinct data series in writes,
+// the indices of the writes belonging to it (in first-seen series order),
+// so WriteBatchWithTaggedAttributes can lock and resolve each series once.
+func groupTAPWritesBySeries(writes []TAPWrite) ([]string, map[string][]int) {
+	indices := make(map[string][]int, len(writes))
+	order := make([]string, 0, len(writes))
+
+	for i, w := range writes {
+		symTableName := "m3_symboltable_" + w.ID.String()
+		if _, ok := indices[symTableName]; !ok {
+			order = append(order, symTableName)
+		}
+		indices[symTableName] = append(indices[symTableName], i)
+	}
+
+	return order, indices
+}
+
+// encodeWriteBatchGroup resolves every write in indices (all belonging to
+// symTableName) against that series' symTableEntry, taking its lock exactly
+// once for the whole group. On success, encodedAnnotations[i] holds the
+// wire annotation for writes[i]; on failure, results[i] holds the error and
+// encodedAnnotations[i] is left nil.
+func (bs *BoostSession) encodeWriteBatchGroup(
+	namespace ident.ID,
+	symTableName string,
+	writes []TAPWrite,
+	indices []int,
+	encodedAnnotations [][]byte,
+	results []error) {
+
+	entry := bs.getOrCreateEntry(symTableName)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	symTable := entry.symTable
+	if symTable == nil {
+		m3dbStreamWriter := core.NewM3DBSymStreamWriter(
+			namespace,
+			ident.StringID(symTableName),
+			bs.session)
+		symTable = core.NewSymTable(symTableName, 1, m3dbStreamWriter)
+		entry.symTable = symTable
+	}
+
+	attrMaps := make([]map[string]string, len(indices))
+	hasMissing := false
+	for j, i := range indices {
+		attrMap := make(map[string]string)
+		for writes[i].Attributes.Next() {
+			attrC := writes[i].Attributes.Current()
+			attrMap[attrC.Name.String()] = attrC.Value.String()
+		}
+		attrMaps[j] = attrMap
+
+		if _, missing := symTable.GetIndexedHeader(attrMap); missing {
+			hasMissing = true
+		}
+	}
+
+	if hasMissing {
+		bs.updateSymbolsAndAttributesUnion(symTable, attrMaps)
+	}
+
+	for j, i := range indices {
+		indexedHeader, missing := symTable.GetIndexedHeader(attrMaps[j])
+		if missing {
+			results[i] = errors.New("unable to find all attributes in the symbol table")
+			continue
+		}
+
+		encodedAnnotations[i] = annotation.Encode(annotation.Annotation{
+			SymTableVersion: symTable.Version(),
+			SymTableHash:    symTable.ContentHash(),
+			IndexedHeader:   indexedHeader,
+		}, annotation.EncodeOptions{})
+	}
+}
+
+// updateSymbolsAndAttributesUnion is the batch counterpart to
+// updateSymbolsAndAttributes: it updates the dictionary once with the union
+// of values missing across every map in attrMaps (UpdateDictionary errors
+// on a value it already holds, so duplicates across - or within - samples
+// must be deduped first), then inserts every (name, value) pair from every
+// map. InsertAttributeValue is a no-op for a pair already present, so it's
+// safe to call once per sample even when samples share attribute values.
+func (bs *BoostSession) updateSymbolsAndAttributesUnion(symTable *core.SymTable, attrMaps []map[string]string) error {
+	seen := make(map[string]struct{})
+	symbols := make([]string, 0, len(attrMaps))
+	for _, attributes := range attrMaps {
+		for _, value := range attributes {
+			if _, ok := seen[value]; ok {
+				continue
+			}
+			seen[value] = struct{}{}
+			if !symTable.AttributeValueExists(value) {
+				symbols = append(symbols, value)
+			}
+		}
+	}
+
+	if len(symbols) > 0 {
+		if err := symTable.UpdateDictionary(symbols, nil); err != nil {
+			return err
+		}
+		bs.scope.Counter("symbol_updates").Inc(int64(len(symbols)))
+	}
+
+	for _, attributes := range attrMaps {
+		for attrName, attrValue := range attributes {
+			if err := symTable.InsertAttributeValue(attrName, attrValue, nil); err != nil {
+				return err
+			}
+			bs.scope.Counter("attribute_updates").Inc(1)
+		}
+	}
+
+	return nil
+}
+
 // Fetch values from the database for an ID.
 func (bs *BoostSession) FetchValueWithTaggedAttribute(
 	namespace ident.ID,
@@ -178,15 +525,54 @@ func (bs *BoostSession) fetchOrCreateSymTable(
 
 	// Find the version encoded in the annotation
 
-	// Check if the symbol table exists for this data series. This is done
-	// under a lock
-	bs.rwControl.Lock()
-	defer bs.rwControl.Unlock()
+	// Find (or create) this data series' symTableEntry, then hydrate it
+	// under entry.mu alone - so hydrating a cold entry for one series
+	// (which may scan a long stream) doesn't block a fetch or write
+	// against any other series.
+	entry := bs.getOrCreateEntry(symTableName)
 
-	symTable, ok := bs.symTables.Get(symTableName)
-	if !ok {
-		var err error = nil
-		symTable, err = bs.readSymTableStream(
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if bs.symTableCache != nil {
+		// The shared SymTableCache already hydrates incrementally from its
+		// own persisted watermark, independent of entry.lastEndTime/
+		// lastSeqNum below - the two caching layers serve different
+		// purposes (cross-process snapshot vs. this process' in-memory
+		// entry) and don't need to agree on a watermark.
+		if entry.symTable == nil {
+			bs.scope.Counter("symtable_cache_misses").Inc(1)
+
+			symTable, err := bs.readSymTableStreamCached(
+				namespaceId,
+				ident.StringID(symTableName),
+				symTableName,
+				version,
+				timeBegin,
+				timeEnd)
+			if err != nil {
+				return nil, err
+			}
+			entry.symTable = symTable
+		} else {
+			bs.scope.Counter("symtable_cache_hits").Inc(1)
+		}
+
+		return entry.symTable, nil
+	}
+
+	if entry.symTable != nil && entry.symTable.Version() != version {
+		// An incremental patch can't straddle a generation boundary -
+		// treat a version change as a cold entry and fall through to a
+		// full rehydrate below.
+		entry.symTable = nil
+	}
+
+	switch {
+	case entry.symTable == nil:
+		bs.scope.Counter("symtable_cache_misses").Inc(1)
+
+		symTable, seqNum, err := bs.readSymTableStream(
 			namespaceId,
 			ident.StringID(symTableName),
 			version,
@@ -195,10 +581,35 @@ func (bs *BoostSession) fetchOrCreateSymTable(
 		if err != nil {
 			return nil, err
 		}
-		bs.symTables.Add(symTableName, symTable)
+		entry.symTable = symTable
+		entry.lastEndTime = timeEnd
+		entry.lastSeqNum = seqNum
+
+	case timeEnd > entry.lastEndTime:
+		bs.scope.Counter("symtable_cache_hits").Inc(1)
+
+		seqNum, err := bs.readSymTableStreamIncremental(
+			entry.symTable,
+			entry.lastSeqNum,
+			namespaceId,
+			ident.StringID(symTableName),
+			version,
+			entry.lastEndTime,
+			timeEnd)
+		if err != nil {
+			// Drop the entry so the next call rehydrates it cold instead of
+			// retrying the same failing incremental read.
+			entry.symTable = nil
+			return nil, err
+		}
+		entry.lastEndTime = timeEnd
+		entry.lastSeqNum = seqNum
+
+	default:
+		bs.scope.Counter("symtable_cache_hits").Inc(1)
 	}
 
-	return symTable, nil
+	return entry.symTable, nil
 }
 
 // Fetch values from the database for an ID.
@@ -278,66 +689,106 @@ func (bs *BoostSession) updateSymbolsAndAttributes(symTable *core.SymTable, attr
 		}
 	}
 
-	err := symTable.UpdateDictionary(symbols)
+	err := symTable.UpdateDictionary(symbols, nil)
 	if err != nil {
 		return err
 	}
-	bs.numSymbolUpdates++
+	bs.scope.Counter("symbol_updates").Inc(int64(len(symbols)))
 
 	// Update the attributes
 	for attrName, attrValue := range attributes {
-		err = symTable.InsertAttributeValue(attrName, attrValue)
+		err = symTable.InsertAttributeValue(attrName, attrValue, nil)
 		if err != nil {
 			return err
 		}
-		bs.numAttributeUpdates++
+		bs.scope.Counter("attribute_updates").Inc(1)
 	}
 
 	return nil
 }
 
-// Use the M3DBSymStreamReader to read the symbol table stream
-func (bs *BoostSession) readSymTableStream(
-	namespace ident.ID,
+// hydrateFromInit scans symTableReader forward from wherever it currently
+// sits for the next InitSymTable instruction carrying version, and returns a
+// freshly initialized symTable built from it along with the InitSymTable's
+// sequence number (always 1).
+func (bs *BoostSession) hydrateFromInit(
+	symTableReader core.SymStreamReader,
 	streamId ident.ID,
-	version uint16,
-	startTime xtime.UnixNano,
-	endTime xtime.UnixNano) (*core.SymTable, error) {
+	version uint16) (*core.SymTable, uint32, error) {
 
-	symTableReader := core.NewM3DBSymStreamReader(namespace, streamId, bs.session)
-	err := symTableReader.Seek(startTime, endTime)
+	_, seqNum, err := bs.findInitInstruction(symTableReader, version)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	// First loop until we find the init instruction matching the requested
-	// version.
-	var (
-		v           uint16
-		seqNum      uint32
-		instruction core.TableInstruction
-	)
-	_, seqNum, err = bs.findInitInstruction(symTableReader, version)
+	instrParams, err := symTableReader.ReadInitInstruction()
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
+	symTable := core.NewSymTable(streamId.String(), version, nil)
+	symTable.UpdateDictionary(instrParams, nil)
 
-	// Read the InitSymTable instruction parameters and add create symtable.
-	instrParams, err := symTableReader.ReadInitInstruction()
+	return symTable, seqNum, nil
+}
+
+// recoverSymTable builds the symTable to resume hydration from after a
+// version mismatch or sequence number gap. If symTableReader is already
+// positioned on an InitSymTable instruction for the requested version - the
+// shape a torn write's restart normally takes - it's read directly rather
+// than scanned past; otherwise hydrateFromInit scans forward for the next
+// one.
+func (bs *BoostSession) recoverSymTable(
+	symTableReader core.SymStreamReader,
+	streamId ident.ID,
+	version uint16,
+	v uint16,
+	instruction core.TableInstruction) (*core.SymTable, uint32, error) {
+
+	if instruction == core.InitSymTable && v == version {
+		instrParams, err := symTableReader.ReadInitInstruction()
+		if err != nil {
+			return nil, 0, err
+		}
+		symTable := core.NewSymTable(streamId.String(), version, nil)
+		symTable.UpdateDictionary(instrParams, nil)
+		return symTable, 1, nil
+	}
+
+	return bs.hydrateFromInit(symTableReader, streamId, version)
+}
+
+// Use the session's configured SymStreamReader (core.NewM3DBSymStreamReader
+// by default) to read the symbol table stream. Returns the hydrated
+// symTable along with the sequence number of the last instruction applied
+// to it, so callers can resume incrementally later; see
+// readSymTableStreamIncremental.
+func (bs *BoostSession) readSymTableStream(
+	namespace ident.ID,
+	streamId ident.ID,
+	version uint16,
+	startTime xtime.UnixNano,
+	endTime xtime.UnixNano) (*core.SymTable, uint32, error) {
+
+	symTableReader := bs.newSymStreamReader(namespace, streamId)
+	if err := symTableReader.Seek(startTime, endTime); err != nil {
+		return nil, 0, err
+	}
+
+	symTable, seqNum, err := bs.hydrateFromInit(symTableReader, streamId, version)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	symTable := core.NewSymTable(streamId.String(), version, nil)
-	symTable.UpdateDictionary(instrParams)
 
 	// Loop through the stream until we find the EndSymTable instruction
 	// or we reach the end of the stream (NOPInstruction). Verify that the
-	// sequence numbers are sequential.
+	// sequence numbers are sequential, recovering from a gap per
+	// bs.recoveryPolicy rather than unconditionally failing.
+	recovered := false
 	for {
 		prevSeqNum := seqNum
-		v, seqNum, instruction, err = symTableReader.Next()
+		v, nextSeqNum, instruction, err := symTableReader.Next()
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		if instruction == core.NOPInstruction {
@@ -347,28 +798,36 @@ func (bs *BoostSession) readSymTableStream(
 		}
 
 		if v != version {
-			// This write must have failed in the middle. We need to search for
-			// the next InitSymTable instruction with the same version.
-			_, seqNum, err = bs.findInitInstruction(symTableReader, version)
+			// This write must have failed in the middle. We need to search
+			// for the next InitSymTable instruction with the same version.
+			symTable, seqNum, err = bs.recoverSymTable(symTableReader, streamId, version, v, instruction)
 			if err != nil {
-				return nil, err
-			}
-			// Read the InitSymTable instruction parameters and add create
-			// symtable.
-			instrParams, err := symTableReader.ReadInitInstruction()
-			if err != nil {
-				return nil, err
+				return nil, 0, err
 			}
-			symTable := core.NewSymTable(streamId.String(), version, nil)
-			symTable.UpdateDictionary(instrParams)
+			continue
 		}
 
-		if seqNum != prevSeqNum+1 {
-			// TODO, should we continue further to find another InitSymTable
-			// instruction with the same version?
-			return nil, errors.New("invalid sequence number")
+		if nextSeqNum != prevSeqNum+1 {
+			switch bs.recoveryPolicy {
+			case SymTableRecoverySkipGaps:
+				if recovered {
+					return nil, 0, errors.New("invalid sequence number")
+				}
+				recovered = true
+				fallthrough
+			case SymTableRecoveryLatestValid:
+				symTable, seqNum, err = bs.recoverSymTable(symTableReader, streamId, version, v, instruction)
+				if err != nil {
+					return nil, 0, err
+				}
+				continue
+			default:
+				return nil, 0, errors.New("invalid sequence number")
+			}
 		}
 
+		seqNum = nextSeqNum
+
 		if instruction == core.EndSymTable {
 			// Last instruction. Finalize the symtable and return
 			symTable.Finalize()
@@ -377,55 +836,276 @@ func (bs *BoostSession) readSymTableStream(
 
 		switch instruction {
 		case core.UpdateSymTable:
-			instrParams, err = symTableReader.ReadUpdateInstruction()
+			instrParams, err := symTableReader.ReadUpdateInstruction()
+			if err != nil {
+				return nil, 0, err
+			}
+			symTable.UpdateDictionary(instrParams, nil)
+		case core.AddAttribute:
+			attrName, _, indexValues, err := symTableReader.ReadAttributeInstruction()
+			if err != nil {
+				return nil, 0, err
+			}
+			symTable.InsertAttributeIndices(attrName, indexValues, nil)
+		case core.DeleteAttributeValue:
+			attrName, index, err := symTableReader.ReadDeleteInstruction()
+			if err != nil {
+				return nil, 0, err
+			}
+			symTable.DeleteAttributeIndex(attrName, index, nil)
+		}
+	}
+
+	return symTable, seqNum, nil
+}
+
+// readSymTableStreamIncremental seeks from just past lastEndTime and applies
+// only the UpdateSymTable/AddAttribute instructions it finds directly onto
+// the already-hydrated symTable, so a fetchOrCreateSymTable call for a range
+// overlapping a previous one doesn't replay from the InitSymTable again. It
+// stops at the first sequence number gap regardless of bs.recoveryPolicy -
+// an incremental patch has nothing to fall back to but a full rehydrate, so
+// on that error fetchOrCreateSymTable drops the entry (entry.symTable = nil)
+// and the next call rehydrates it cold; this helper attempts no stream
+// recovery itself.
+func (bs *BoostSession) readSymTableStreamIncremental(
+	symTable *core.SymTable,
+	lastSeqNum uint32,
+	namespace ident.ID,
+	streamId ident.ID,
+	version uint16,
+	lastEndTime xtime.UnixNano,
+	endTime xtime.UnixNano) (uint32, error) {
+
+	symTableReader := bs.newSymStreamReader(namespace, streamId)
+	if err := symTableReader.Seek(lastEndTime+1, endTime); err != nil {
+		return 0, err
+	}
+
+	seqNum := lastSeqNum
+	for {
+		prevSeqNum := seqNum
+		v, nextSeqNum, instruction, err := symTableReader.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		if instruction == core.NOPInstruction {
+			break
+		}
+		if v != version || nextSeqNum != prevSeqNum+1 {
+			return 0, errors.New("invalid sequence number")
+		}
+		seqNum = nextSeqNum
+
+		switch instruction {
+		case core.UpdateSymTable:
+			instrParams, err := symTableReader.ReadUpdateInstruction()
+			if err != nil {
+				return 0, err
+			}
+			symTable.UpdateDictionary(instrParams, nil)
+		case core.AddAttribute:
+			attrName, _, indexValues, err := symTableReader.ReadAttributeInstruction()
+			if err != nil {
+				return 0, err
+			}
+			symTable.InsertAttributeIndices(attrName, indexValues, nil)
+		case core.DeleteAttributeValue:
+			attrName, index, err := symTableReader.ReadDeleteInstruction()
+			if err != nil {
+				return 0, err
+			}
+			symTable.DeleteAttributeIndex(attrName, index, nil)
+		case core.EndSymTable:
+			symTable.Finalize()
+		}
+	}
+
+	return seqNum, nil
+}
+
+// symTableCacheOp is a single decoded instruction captured while scanning
+// the symbol table stream, so it can be stashed in a SymTableCache and
+// replayed later without re-reading the underlying stream. Unlike
+// SymTableBuilder's snapshot (which stores raw wire bytes), the BoostSession
+// read path only ever sees already-decoded instructions, so the cached
+// records here are gob-encoded operations instead.
+type symTableCacheOp struct {
+	IsAttribute  bool
+	IsDelete     bool
+	DictValues   []string
+	AttrName     string
+	Indices      []uint64
+	DeletedIndex uint64
+}
+
+func encodeSymTableCacheOp(op symTableCacheOp) []byte {
+	var buf bytes.Buffer
+	// Errors are impossible here: the buffer never errors and symTableCacheOp
+	// contains nothing gob can't encode.
+	_ = gob.NewEncoder(&buf).Encode(op)
+	return buf.Bytes()
+}
+
+func decodeSymTableCacheOp(raw []byte) (symTableCacheOp, error) {
+	var op symTableCacheOp
+	err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&op)
+	return op, err
+}
+
+// readSymTableStreamCached is the cache-assisted counterpart to
+// readSymTableStream: it hydrates from the most recent snapshot in
+// bs.symTableCache (if any) and only scans the stream from the snapshot's
+// watermark onwards, persisting the extended snapshot back before
+// returning. It intentionally duplicates readSymTableStream's scan loop
+// rather than modifying it, since that function's recovery semantics are
+// evolving independently.
+func (bs *BoostSession) readSymTableStreamCached(
+	namespace ident.ID,
+	streamId ident.ID,
+	symTableName string,
+	version uint16,
+	startTime xtime.UnixNano,
+	endTime xtime.UnixNano) (*core.SymTable, error) {
+
+	symTable := core.NewSymTable(streamId.String(), version, nil)
+	var cachedOps [][]byte
+	fetchBegin := startTime
+	haveInit := false
+
+	if snapshot, ok := bs.symTableCache.Get(symTableName, uint64(version)); ok {
+		hydrated := core.NewSymTable(streamId.String(), version, nil)
+		hydrateErr := false
+		for _, raw := range snapshot.Records {
+			op, err := decodeSymTableCacheOp(raw)
+			if err != nil {
+				hydrateErr = true
+				break
+			}
+			switch {
+			case op.IsDelete:
+				hydrated.DeleteAttributeIndex(op.AttrName, op.DeletedIndex, nil)
+			case op.IsAttribute:
+				hydrated.InsertAttributeIndices(op.AttrName, op.Indices, nil)
+			default:
+				hydrated.UpdateDictionary(op.DictValues, nil)
+			}
+		}
+		if hydrateErr {
+			bs.symTableCache.Invalidate(symTableName, uint64(version))
+		} else {
+			symTable = hydrated
+			cachedOps = snapshot.Records
+			fetchBegin = snapshot.Watermark + 1
+			haveInit = true
+		}
+	}
+
+	symTableReader := core.NewM3DBSymStreamReader(namespace, streamId, bs.session)
+	if err := symTableReader.Seek(fetchBegin, endTime); err != nil {
+		return nil, err
+	}
+
+	var tailOps [][]byte
+	// The reader doesn't surface a per-instruction timestamp, so the
+	// watermark is the end of the scanned range: the next incremental fetch
+	// resumes immediately after it.
+	watermark := endTime
+
+	if !haveInit {
+		_, seqNum, err := bs.findInitInstruction(symTableReader, version)
+		if err != nil {
+			return nil, err
+		}
+		if seqNum != 1 {
+			return nil, errors.New("invalid sequence number for InitSymTable")
+		}
+		instrParams, err := symTableReader.ReadInitInstruction()
+		if err != nil {
+			return nil, err
+		}
+		symTable.UpdateDictionary(instrParams, nil)
+	}
+
+	for {
+		_, _, instruction, err := symTableReader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if instruction == core.NOPInstruction {
+			break
+		}
+
+		switch instruction {
+		case core.UpdateSymTable:
+			instrParams, err := symTableReader.ReadUpdateInstruction()
 			if err != nil {
 				return nil, err
 			}
-			symTable.UpdateDictionary(instrParams)
+			symTable.UpdateDictionary(instrParams, nil)
+			tailOps = append(tailOps, encodeSymTableCacheOp(symTableCacheOp{DictValues: instrParams}))
 		case core.AddAttribute:
 			attrName, _, indexValues, err := symTableReader.ReadAttributeInstruction()
 			if err != nil {
 				return nil, err
 			}
-			symTable.InsertAttributeIndices(attrName, indexValues)
+			symTable.InsertAttributeIndices(attrName, indexValues, nil)
+			tailOps = append(tailOps, encodeSymTableCacheOp(symTableCacheOp{
+				IsAttribute: true,
+				AttrName:    attrName,
+				Indices:     indexValues,
+			}))
+		case core.DeleteAttributeValue:
+			attrName, index, err := symTableReader.ReadDeleteInstruction()
+			if err != nil {
+				return nil, err
+			}
+			symTable.DeleteAttributeIndex(attrName, index, nil)
+			tailOps = append(tailOps, encodeSymTableCacheOp(symTableCacheOp{
+				IsDelete:     true,
+				AttrName:     attrName,
+				DeletedIndex: index,
+			}))
+		case core.EndSymTable:
+			symTable.Finalize()
 		}
 	}
 
+	if len(tailOps) > 0 {
+		merged := make([][]byte, 0, len(cachedOps)+len(tailOps))
+		merged = append(merged, cachedOps...)
+		merged = append(merged, tailOps...)
+		bs.symTableCache.Put(symTableName, uint64(version), &SymTableCacheSnapshot{
+			Records:   merged,
+			Watermark: watermark,
+		})
+	}
+
 	return symTable, nil
 }
 
 // Find the InitSymTable instruction in the stream for a symbol table having
 // the specified version and return the symtable version, sequence number and
-// any error.
+// any error. Returns an error rather than looping forever if the stream ends
+// (NOPInstruction) before such an instruction is found.
 func (bs *BoostSession) findInitInstruction(
-	symTableReader *core.M3DBSymStreamReader,
+	symTableReader core.SymStreamReader,
 	version uint16) (uint16, uint32, error) {
 
-	// First loop until we find the init instruction matching the requested
-	// version.
-	var (
-		v           uint16
-		seqNum      uint32
-		instruction core.TableInstruction
-		err         error
-	)
 	for {
-		v, seqNum, instruction, err = symTableReader.Next()
+		v, seqNum, instruction, err := symTableReader.Next()
 		if err != nil {
 			return 0, 0, err
 		}
+		if instruction == core.NOPInstruction {
+			return 0, 0, errors.New("reached end of stream without finding InitSymTable")
+		}
 		if instruction == core.InitSymTable && version == v {
-			break
+			if seqNum != 1 {
+				return 0, 0, errors.New("invalid sequence number for InitSymTable")
+			}
+			return v, seqNum, nil
 		}
 	}
-
-	if instruction != core.InitSymTable {
-		return 0, 0, errors.New("unable to find InitSymTable instruction")
-	} else if seqNum != 1 {
-		return 0, 0, errors.New("invalid sequence number for InitSymTable")
-	} else if version != v {
-		return 0, 0, errors.New("could not find a valid symtable with the specified version")
-	}
-
-	return v, seqNum, nil
 }
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m3db/m3/src/boost/core"
+	"github.com/m3db/m3/src/x/ident"
+	xtime "github.com/m3db/m3/src/x/time"
+)
+
+// fakeStreamInstruction is a single scripted step a fakeSymStreamReader
+// replays from Next/Read*Instruction, letting a test build a torn-write
+// stream (e.g. a sequence number gap) without a real backing store.
+type fakeStreamInstruction struct {
+	version     uint16
+	seqNum      uint32
+	instruction core.TableInstruction
+
+	// dictValues backs ReadInitInstruction/ReadUpdateInstruction.
+	dictValues []string
+}
+
+// fakeSymStreamReader is a core.SymStreamReader driven entirely by a
+// pre-scripted slice of instructions, so tests can inject gaps and
+// version-mismatches that a real stream would only produce from a torn
+// write.
+type fakeSymStreamReader struct {
+	instructions []fakeStreamInstruction
+	pos          int
+	current      fakeStreamInstruction
+}
+
+func (r *fakeSymStreamReader) Seek(startTime, endTime xtime.UnixNano) error {
+	r.pos = 0
+	return nil
+}
+
+func (r *fakeSymStreamReader) Next() (uint16, uint32, core.TableInstruction, error) {
+	if r.pos >= len(r.instructions) {
+		return 0, 0, core.NOPInstruction, nil
+	}
+	r.current = r.instructions[r.pos]
+	r.pos++
+	return r.current.version, r.current.seqNum, r.current.instruction, nil
+}
+
+func (r *fakeSymStreamReader) ReadInitInstruction() ([]string, error) {
+	if r.current.instruction != core.InitSymTable {
+		return nil, errors.New("not seeked to InitSymTable")
+	}
+	return r.current.dictValues, nil
+}
+
+func (r *fakeSymStreamReader) ReadUpdateInstruction() ([]string, error) {
+	if r.current.instruction != core.UpdateSymTable {
+		return nil, errors.New("not seeked to UpdateSymTable")
+	}
+	return r.current.dictValues, nil
+}
+
+func (r *fakeSymStreamReader) ReadAttributeInstruction() (string, core.AttributeEncoding, []uint64, error) {
+	return "", 0, nil, errors.New("not seeked to AddAttribute")
+}
+
+func (r *fakeSymStreamReader) ReadDeleteInstruction() (string, uint64, error) {
+	return "", 0, errors.New("not seeked to DeleteAttributeValue")
+}
+
+func (r *fakeSymStreamReader) ReadEndInstruction() (string, []uint64, error) {
+	if r.current.instruction != core.EndSymTable {
+		return "", nil, errors.New("not seeked to EndSymTable")
+	}
+	return "", nil, nil
+}
+
+func (r *fakeSymStreamReader) Follow(ctx context.Context, startTime xtime.UnixNano) (<-chan core.Instruction, error) {
+	return nil, errors.New("Follow not supported by fakeSymStreamReader")
+}
+
+func newBoostSessionWithFakeReader(policy SymTableRecoveryPolicy, reader *fakeSymStreamReader) *BoostSession {
+	bs := NewBoostSessionWithRecoveryPolicy(fakeWriteOnlySession{}, 16, policy)
+	bs.newSymStreamReader = func(namespace, streamId ident.ID) core.SymStreamReader {
+		return reader
+	}
+	return bs
+}
+
+// torn-write stream: InitSymTable(seq 1) with "a", UpdateSymTable(seq 2)
+// with "b", then a gap straight to a second InitSymTable(seq 1) with "c",
+// UpdateSymTable(seq 2) with "d", EndSymTable(seq 3).
+func tornStreamInstructions() []fakeStreamInstruction {
+	return []fakeStreamInstruction{
+		{version: 1, seqNum: 1, instruction: core.InitSymTable, dictValues: []string{"a"}},
+		{version: 1, seqNum: 2, instruction: core.UpdateSymTable, dictValues: []string{"b"}},
+		{version: 1, seqNum: 1, instruction: core.InitSymTable, dictValues: []string{"c"}},
+		{version: 1, seqNum: 2, instruction: core.UpdateSymTable, dictValues: []string{"d"}},
+		{version: 1, seqNum: 3, instruction: core.EndSymTable},
+	}
+}
+
+func TestReadSymTableStreamStrictFailsOnGap(t *testing.T) {
+	reader := &fakeSymStreamReader{instructions: tornStreamInstructions()}
+	bs := newBoostSessionWithFakeReader(SymTableRecoveryStrict, reader)
+
+	_, _, err := bs.readSymTableStream(
+		ident.StringID("ns"), ident.StringID("stream"), 1, 0, 100)
+	if err == nil {
+		t.Fatal("expected an error from the sequence number gap")
+	}
+}
+
+func TestReadSymTableStreamSkipGapsRecoversToLatest(t *testing.T) {
+	reader := &fakeSymStreamReader{instructions: tornStreamInstructions()}
+	bs := newBoostSessionWithFakeReader(SymTableRecoverySkipGaps, reader)
+
+	symTable, _, err := bs.readSymTableStream(
+		ident.StringID("ns"), ident.StringID("stream"), 1, 0, 100)
+	if err != nil {
+		t.Fatalf("expected recovery to succeed, got %v", err)
+	}
+	if symTable.AttributeValueExists("a") {
+		t.Fatal("expected the pre-gap generation's values to be discarded")
+	}
+	if !symTable.AttributeValueExists("c") || !symTable.AttributeValueExists("d") {
+		t.Fatal("expected the post-gap generation's values to be present")
+	}
+}
+
+func TestReadSymTableStreamSkipGapsFailsOnSecondGap(t *testing.T) {
+	instructions := tornStreamInstructions()
+	// Truncate the EndSymTable and splice in a second gap straight to a
+	// third generation, so SkipGaps has already spent its one recovery.
+	instructions = append(instructions[:4],
+		fakeStreamInstruction{version: 1, seqNum: 1, instruction: core.InitSymTable, dictValues: []string{"e"}})
+	reader := &fakeSymStreamReader{instructions: instructions}
+	bs := newBoostSessionWithFakeReader(SymTableRecoverySkipGaps, reader)
+
+	_, _, err := bs.readSymTableStream(
+		ident.StringID("ns"), ident.StringID("stream"), 1, 0, 100)
+	if err == nil {
+		t.Fatal("expected the second gap to fail under SymTableRecoverySkipGaps")
+	}
+}
+
+func TestReadSymTableStreamLatestValidRecoversThroughMultipleGaps(t *testing.T) {
+	instructions := tornStreamInstructions()
+	instructions = append(instructions[:4],
+		fakeStreamInstruction{version: 1, seqNum: 1, instruction: core.InitSymTable, dictValues: []string{"e"}},
+		fakeStreamInstruction{version: 1, seqNum: 2, instruction: core.EndSymTable})
+	reader := &fakeSymStreamReader{instructions: instructions}
+	bs := newBoostSessionWithFakeReader(SymTableRecoveryLatestValid, reader)
+
+	symTable, _, err := bs.readSymTableStream(
+		ident.StringID("ns"), ident.StringID("stream"), 1, 0, 100)
+	if err != nil {
+		t.Fatalf("expected recovery through both gaps to succeed, got %v", err)
+	}
+	if symTable.AttributeValueExists("c") || symTable.AttributeValueExists("d") {
+		t.Fatal("expected the middle generation's values to be discarded too")
+	}
+	if !symTable.AttributeValueExists("e") {
+		t.Fatal("expected the final generation's values to be present")
+	}
+}
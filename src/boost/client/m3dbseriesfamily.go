@@ -1,6 +1,7 @@
 package client
 
 import (
+	gocontext "context"
 	"errors"
 	"fmt"
 	"sync"
@@ -8,10 +9,19 @@ import (
 	"time"
 
 	"github.com/m3db/m3/src/boost/core"
+	"github.com/m3db/m3/src/dbnode/storage/index"
+	"github.com/m3db/m3/src/m3ninx/idx"
 	"github.com/m3db/m3/src/x/ident"
 	xtime "github.com/m3db/m3/src/x/time"
 )
 
+// c_SeriesFamilyTagName is the M3DB-indexed tag every series written
+// through a M3DBSeriesFamily carries, identifying which family it belongs
+// to. Namespace alone doesn't distinguish families - two families can
+// share one - so FetchByAttributes queries on this tag to scope its scan
+// to just this family's series instead of the whole namespace.
+const c_SeriesFamilyTagName = "m3_family"
+
 // Implements the SeriesFamily interface
 type M3DBSeriesFamily struct {
 	// Name of the table
@@ -146,7 +156,7 @@ func (sf *M3DBSeriesFamily) WriteTagged(
 	return sf.session.WriteValueWithTaggedAttributes(
 		sf.namespace,
 		qualifiedId,
-		tags,
+		sf.withFamilyTag(tags),
 		attributes,
 		timestamp,
 		value,
@@ -165,7 +175,7 @@ func (sf *M3DBSeriesFamily) Fetch(
 	id ident.ID,
 	startInclusive xtime.UnixNano,
 	endExclusive xtime.UnixNano,
-) (*BoostSeriesIterator, error) {
+) (core.SeriesIterator, error) {
 	seriesIt, err := sf.session.Fetch(
 		sf.namespace, id, startInclusive, endExclusive)
 	if err != nil {
@@ -174,18 +184,94 @@ func (sf *M3DBSeriesFamily) Fetch(
 
 	return NewBoostSeriesIterator(
 		seriesIt,
-		sf.symbolTableStreamNameResolver,
 		sf.session.fetchOrCreateSymTable,
 		startInclusive,
 		endExclusive), nil
 }
 
+// FetchByAttributes scans every series in the family between startInclusive
+// and endExclusive whose attributes match attrs. The family's own SymTable
+// (named by symbolTableStreamNameResolver) is consulted first: if any
+// predicate value doesn't exist anywhere in it, no series could possibly
+// match and the scan is skipped entirely. Otherwise FetchTagged is scoped
+// to this family via c_SeriesFamilyTagName (every series WriteTagged
+// writes carries it), and M3DBSeriesFamilyIterator resolves attrs to an
+// indexed-header mask per candidate series - via its own per-series
+// SymTable, since every series is written with its own independent
+// dictionary - so a row's attributes are only reconstructed once it's
+// actually matched.
+func (sf *M3DBSeriesFamily) FetchByAttributes(
+	attrs ident.TagIterator,
+	startInclusive xtime.UnixNano,
+	endExclusive xtime.UnixNano,
+	opts core.FetchOptions,
+) (core.SeriesFamilyIterator, error) {
+
+	attrMap := make(map[string]string)
+	for attrs.Next() {
+		attrC := attrs.Current()
+		attrMap[attrC.Name.String()] = attrC.Value.String()
+	}
+
+	familySymTableName := sf.symbolTableStreamNameResolver(nil)
+	familySymTable, err := sf.session.fetchOrCreateSymTable(
+		sf.namespace, familySymTableName, sf.version, startInclusive, endExclusive)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range attrMap {
+		if familySymTable.FindAttributeIndex(name, value) == -1 {
+			// This exact value has never been recorded against the family
+			// table, so no series in it can match - skip the scan.
+			return newM3DBSeriesFamilyIterator(nil, nil, attrMap, opts, startInclusive, endExclusive), nil
+		}
+	}
+
+	seriesIters, _, err := sf.session.FetchTagged(
+		gocontext.Background(),
+		sf.namespace,
+		index.Query{Query: idx.NewTermQuery([]byte(c_SeriesFamilyTagName), []byte(sf.name))},
+		index.QueryOptions{StartInclusive: startInclusive.ToTime(), EndExclusive: endExclusive.ToTime()})
+	if err != nil {
+		return nil, err
+	}
+
+	return newM3DBSeriesFamilyIterator(
+		seriesIters, sf.session.fetchOrCreateSymTable, attrMap, opts, startInclusive, endExclusive), nil
+}
+
 func (sf *M3DBSeriesFamily) symbolTableStreamNameResolver(
 	qualifiedSeriesId ident.ID) string {
 	return "m3_symboltable_sf_" + sf.name
 	//+ core.GetSeriesName(qualifiedSeriesId.String())
 }
 
+// withFamilyTag returns a TagIterator carrying every tag in tags (nil is
+// treated as no tags) plus c_SeriesFamilyTagName identifying this family,
+// so FetchByAttributes can scope its FetchTagged query to just this
+// family's series. Tag values are copied out via String() rather than
+// held by reference, since a TagIterator's Current() isn't guaranteed
+// valid past the next Next() call (see WriteValueWithTaggedAttributes's
+// own attrMap build-up).
+func (sf *M3DBSeriesFamily) withFamilyTag(tags ident.TagIterator) ident.TagIterator {
+	tagList := make([]ident.Tag, 0)
+	if tags != nil {
+		for tags.Next() {
+			tagC := tags.Current()
+			tagList = append(tagList, ident.Tag{
+				Name:  ident.StringID(tagC.Name.String()),
+				Value: ident.StringID(tagC.Value.String()),
+			})
+		}
+	}
+	tagList = append(tagList, ident.Tag{
+		Name:  ident.StringID(c_SeriesFamilyTagName),
+		Value: ident.StringID(sf.name),
+	})
+	return ident.NewTagsIterator(ident.NewTags(tagList...))
+}
+
 // Wait if there are too many pending writes
 func (sf *M3DBSeriesFamily) waitIfTooManyPendingWrites() {
 	for {
@@ -0,0 +1,268 @@
+package client
+
+import (
+	"github.com/m3db/m3/src/boost/core"
+	"github.com/m3db/m3/src/dbnode/encoding"
+	"github.com/m3db/m3/src/x/ident"
+	xtime "github.com/m3db/m3/src/x/time"
+)
+
+// aggregateState accumulates a single FetchOptions.Aggregations entry as
+// M3DBSeriesFamilyIterator walks matched rows.
+type aggregateState struct {
+	fn    core.AggregationFunc
+	sum   float64
+	count int64
+	min   float64
+	max   float64
+}
+
+func (a *aggregateState) observe(value float64) {
+	switch a.fn {
+	case core.AggregationSum, core.AggregationAvg:
+		a.sum += value
+	case core.AggregationMin:
+		if a.count == 0 || value < a.min {
+			a.min = value
+		}
+	case core.AggregationMax:
+		if a.count == 0 || value > a.max {
+			a.max = value
+		}
+	}
+	a.count++
+}
+
+func (a *aggregateState) result() float64 {
+	switch a.fn {
+	case core.AggregationSum:
+		return a.sum
+	case core.AggregationCount:
+		return float64(a.count)
+	case core.AggregationMin:
+		return a.min
+	case core.AggregationMax:
+		return a.max
+	case core.AggregationAvg:
+		if a.count == 0 {
+			return 0
+		}
+		return a.sum / float64(a.count)
+	default:
+		return 0
+	}
+}
+
+// M3DBSeriesFamilyIterator implements core.SeriesFamilyIterator over the
+// series M3DBSeriesFamily.FetchByAttributes scanned via FetchTagged. It
+// wraps each underlying series in a BoostSeriesIterator - the same
+// per-series annotation decode/SymTable cache Fetch already relies on -
+// and resolves attrMap to an indexed-header mask once per series (via
+// SymTable.ResolvePredicateMask), so every datapoint is tested against the
+// predicate with a handful of integer comparisons against its raw
+// IndexedHeader; the full string attribute map is only reconstructed once
+// a row actually matches. Matched rows also feed any requested
+// FetchOptions.Aggregations incrementally.
+type M3DBSeriesFamilyIterator struct {
+	fetchSymTableFn SymTableFetchFunction
+	attrMap         map[string]string
+	opts            core.FetchOptions
+	startTime       xtime.UnixNano
+	endTime         xtime.UnixNano
+
+	seriesIters []encoding.SeriesIterator
+	seriesPos   int
+	current     *BoostSeriesIterator
+
+	// maskSymTable is the SymTable predicateMask was last resolved
+	// against; it's recomputed whenever IndexedHeader hands back a
+	// different table (a new series, or the current series' table moved
+	// to a new generation mid-scan).
+	maskSymTable    *core.SymTable
+	predicateMask   map[int]uint64
+	predicateMaskOK bool
+
+	curId         ident.ID
+	curAttributes map[string]string
+	curTime       xtime.UnixNano
+	curValue      float64
+
+	yielded    int
+	err        error
+	aggregates map[string]*aggregateState
+}
+
+func newM3DBSeriesFamilyIterator(
+	seriesIters encoding.SeriesIterators,
+	fetchSymTableFn SymTableFetchFunction,
+	attrMap map[string]string,
+	opts core.FetchOptions,
+	startTime xtime.UnixNano,
+	endTime xtime.UnixNano,
+) *M3DBSeriesFamilyIterator {
+	aggregates := make(map[string]*aggregateState, len(opts.Aggregations))
+	for name, fn := range opts.Aggregations {
+		aggregates[name] = &aggregateState{fn: fn}
+	}
+
+	var iters []encoding.SeriesIterator
+	if seriesIters != nil {
+		iters = seriesIters.Iters()
+	}
+
+	return &M3DBSeriesFamilyIterator{
+		fetchSymTableFn: fetchSymTableFn,
+		attrMap:         attrMap,
+		opts:            opts,
+		startTime:       startTime,
+		endTime:         endTime,
+		seriesIters:     iters,
+		seriesPos:       -1,
+		aggregates:      aggregates,
+	}
+}
+
+// Next advances to the next row matching the predicate, skipping over
+// non-matching datapoints and exhausted series along the way.
+func (it *M3DBSeriesFamilyIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.opts.Limit > 0 && it.yielded >= it.opts.Limit {
+		return false
+	}
+
+	for {
+		if it.current == nil && !it.advanceSeries() {
+			return false
+		}
+
+		for it.current.Next() {
+			dp, _, _ := it.current.Current()
+			header, symTable, err := it.current.IndexedHeader()
+			if err != nil {
+				it.err = err
+				return false
+			}
+
+			if symTable != it.maskSymTable {
+				it.predicateMask, it.predicateMaskOK = symTable.ResolvePredicateMask(it.attrMap)
+				it.maskSymTable = symTable
+			}
+			if !it.predicateMaskOK {
+				// No row built from this series' table can satisfy
+				// attrMap - stop scanning it instead of paying for a
+				// per-row comparison that can never succeed.
+				break
+			}
+			if !headerMatchesMask(header, it.predicateMask) {
+				continue
+			}
+
+			rowAttrs := symTable.GetAttributesFromIndexedHeader(header)
+			it.observeAggregates(rowAttrs, dp.Value)
+
+			it.curId = it.current.ID()
+			it.curAttributes = projectAttributes(rowAttrs, it.opts.Projection)
+			it.curTime = dp.TimestampNanos
+			it.curValue = dp.Value
+			it.yielded++
+			return true
+		}
+
+		if err := it.current.Err(); err != nil {
+			it.err = err
+			return false
+		}
+
+		it.current.Close()
+		it.current = nil
+	}
+}
+
+// advanceSeries moves to the next underlying series, wrapping it in a
+// BoostSeriesIterator. Returns false once every series has been consumed.
+func (it *M3DBSeriesFamilyIterator) advanceSeries() bool {
+	it.seriesPos++
+	if it.seriesPos >= len(it.seriesIters) {
+		return false
+	}
+
+	it.current = NewBoostSeriesIterator(
+		it.seriesIters[it.seriesPos],
+		it.fetchSymTableFn,
+		it.startTime,
+		it.endTime)
+	return true
+}
+
+// observeAggregates feeds a matched row into every configured aggregate
+// whose attribute the row carries. Rows are not split by that attribute's
+// value: each aggregate covers every matched row that has the attribute.
+func (it *M3DBSeriesFamilyIterator) observeAggregates(rowAttrs map[string]string, value float64) {
+	for name, agg := range it.aggregates {
+		if _, ok := rowAttrs[name]; ok {
+			agg.observe(value)
+		}
+	}
+}
+
+// Aggregates returns the final accumulated value for every attribute name
+// in FetchOptions.Aggregations, once the iterator has been exhausted via
+// Next.
+func (it *M3DBSeriesFamilyIterator) Aggregates() map[string]float64 {
+	results := make(map[string]float64, len(it.aggregates))
+	for name, agg := range it.aggregates {
+		results[name] = agg.result()
+	}
+	return results
+}
+
+// Current returns the current matched row.
+func (it *M3DBSeriesFamilyIterator) Current() (ident.ID, map[string]string, xtime.UnixNano, float64) {
+	return it.curId, it.curAttributes, it.curTime, it.curValue
+}
+
+// Err returns any error encountered while scanning or decoding.
+func (it *M3DBSeriesFamilyIterator) Err() error {
+	return it.err
+}
+
+// Close closes the iterator and any underlying series iterator still open.
+func (it *M3DBSeriesFamilyIterator) Close() {
+	if it.current != nil {
+		it.current.Close()
+		it.current = nil
+	}
+	for _, seriesIt := range it.seriesIters {
+		seriesIt.Close()
+	}
+}
+
+// headerMatchesMask reports whether header - a datapoint's raw
+// IndexedHeader - satisfies every position/index pair in mask, as
+// resolved by SymTable.ResolvePredicateMask.
+func headerMatchesMask(header []int, mask map[int]uint64) bool {
+	for pos, index := range mask {
+		if pos >= len(header) || header[pos] != int(index) {
+			return false
+		}
+	}
+	return true
+}
+
+// projectAttributes trims rowAttrs down to projection's columns. An empty
+// projection returns rowAttrs unchanged.
+func projectAttributes(rowAttrs map[string]string, projection []string) map[string]string {
+	if len(projection) == 0 {
+		return rowAttrs
+	}
+
+	projected := make(map[string]string, len(projection))
+	for _, name := range projection {
+		if value, ok := rowAttrs[name]; ok {
+			projected[name] = value
+		}
+	}
+	return projected
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/m3db/m3/src/boost/core"
+	"github.com/stretchr/testify/require"
+)
+
+// headerMatchesMask, projectAttributes and the aggregateState accumulators
+// are the pieces of M3DBSeriesFamilyIterator that don't depend on a real
+// encoding.SeriesIterator/index.Query, so they're what's covered here -
+// there's no fake for dbnode's SeriesIterator anywhere in this tree to
+// drive Next/FetchByAttributes end to end.
+
+func TestHeaderMatchesMask(t *testing.T) {
+	header := []int{0, 2, -1}
+
+	require.True(t, headerMatchesMask(header, map[int]uint64{0: 0, 1: 2}))
+	require.False(t, headerMatchesMask(header, map[int]uint64{1: 1}))
+	// A position the mask references but header doesn't have (too short)
+	// is a mismatch, not a panic.
+	require.False(t, headerMatchesMask(header, map[int]uint64{5: 0}))
+	// An empty mask (no predicate) matches every row.
+	require.True(t, headerMatchesMask(header, map[int]uint64{}))
+}
+
+func TestProjectAttributes(t *testing.T) {
+	rowAttrs := map[string]string{"host": "a", "region": "us-east"}
+
+	require.Equal(t, rowAttrs, projectAttributes(rowAttrs, nil))
+
+	projected := projectAttributes(rowAttrs, []string{"region"})
+	require.Equal(t, map[string]string{"region": "us-east"}, projected)
+
+	// A projected column the row doesn't have is silently dropped rather
+	// than included as an empty string.
+	projected = projectAttributes(rowAttrs, []string{"region", "missing"})
+	require.Equal(t, map[string]string{"region": "us-east"}, projected)
+}
+
+func TestAggregateStateSumAvgMinMax(t *testing.T) {
+	sum := &aggregateState{fn: core.AggregationSum}
+	sum.observe(2)
+	sum.observe(3)
+	require.Equal(t, float64(5), sum.result())
+
+	avg := &aggregateState{fn: core.AggregationAvg}
+	avg.observe(2)
+	avg.observe(4)
+	require.Equal(t, float64(3), avg.result())
+
+	min := &aggregateState{fn: core.AggregationMin}
+	min.observe(5)
+	min.observe(-1)
+	min.observe(2)
+	require.Equal(t, float64(-1), min.result())
+
+	max := &aggregateState{fn: core.AggregationMax}
+	max.observe(5)
+	max.observe(9)
+	max.observe(2)
+	require.Equal(t, float64(9), max.result())
+
+	count := &aggregateState{fn: core.AggregationCount}
+	count.observe(1)
+	count.observe(1)
+	count.observe(1)
+	require.Equal(t, float64(3), count.result())
+}
@@ -2,9 +2,7 @@ package client
 
 import (
 	"fmt"
-	"sync"
 	"sync/atomic"
-	"time"
 
 	"github.com/m3db/m3/src/boost/core"
 	"github.com/m3db/m3/src/x/ident"
@@ -34,14 +32,10 @@ type M3DBTAPTable struct {
 	// Dictionary Limit
 	dictionaryLimit uint32
 
-	// Max concurrent writes
-	maxConcurrentWrites uint32
-
-	// Write control mutex
-	writeControlMutex sync.Mutex
-
-	// Atomic write counter for pending writes
-	pendingWrites atomic.Uint32
+	// Buffers and flushes WriteTagged calls downstream, admitting writes
+	// via a bounded semaphore instead of the busy-wait backpressure this
+	// table used to spin on.
+	mempool *TAPWriteMempool
 }
 
 // NewM3DBTAPTable creates a new M3DBTAPTable
@@ -52,7 +46,7 @@ func NewM3DBTAPTable(
 	session *BoostSession,
 	distributionFactor uint32,
 	dictionaryLimit uint32,
-	maxConcurrentWrites uint32,
+	mempoolConfig TAPWriteMempoolConfig,
 ) *M3DBTAPTable {
 	ret := &M3DBTAPTable{
 		name:                  name,
@@ -62,12 +56,9 @@ func NewM3DBTAPTable(
 		distributionFactor:    distributionFactor,
 		nextDistributionIndex: atomic.Uint32{},
 		dictionaryLimit:       dictionaryLimit,
-		maxConcurrentWrites:   maxConcurrentWrites,
-		writeControlMutex:     sync.Mutex{},
-		pendingWrites:         atomic.Uint32{},
 	}
-	ret.pendingWrites.Store(0)
 	ret.nextDistributionIndex.Store(0)
+	ret.mempool = NewTAPWriteMempool(mempoolConfig, ret.flush)
 
 	return ret
 }
@@ -82,8 +73,16 @@ func (t *M3DBTAPTable) Namespace() ident.ID {
 	return t.namespace
 }
 
+// Close stops the table's background flusher, flushing whatever is still
+// buffered first.
+func (t *M3DBTAPTable) Close() {
+	t.mempool.Close()
+}
+
 // WriteTagged writes a float64 value into the table having the specified attributes
-// and timestamp.
+// and timestamp. The write is buffered in the table's TAPWriteMempool and
+// handed to the underlying session on the mempool's background flusher;
+// completionFn fires once that flush actually issues the write.
 func (t *M3DBTAPTable) WriteTagged(
 	id ident.ID,
 	attributes ident.TagIterator,
@@ -92,16 +91,6 @@ func (t *M3DBTAPTable) WriteTagged(
 	unit xtime.Unit,
 	completionFn core.TAPWriteCompletionFn) {
 
-	// First check and wait if we have too many pending writes
-	if t.pendingWrites.Load() >= t.maxConcurrentWrites {
-		for t.pendingWrites.Load() >= t.maxConcurrentWrites {
-			// Sleep for 100 microseconds
-			time.Sleep(100 * time.Microsecond)
-		}
-
-		t.pendingWrites.Store(0)
-	}
-
 	// Find the id from the distribution factor
 	nextDistributionIndex := t.nextDistributionIndex.Load() % t.distributionFactor
 	prefix := fmt.Sprintf("m3_dist_%d_", nextDistributionIndex)
@@ -109,13 +98,36 @@ func (t *M3DBTAPTable) WriteTagged(
 	// Find the modified id
 	id = ident.StringID(prefix + id.String())
 
-	t.session.WriteValueWithTaggedAttributes(
-		t.namespace,
-		id,
-		nil,
-		attributes,
-		timestamp,
-		value,
-		unit,
-		completionFn)
+	t.mempool.Submit(tapWriteMempoolEntry{
+		seriesKey:    id.String(),
+		id:           id,
+		attributes:   attributes,
+		timestamp:    timestamp,
+		value:        value,
+		unit:         unit,
+		completionFn: completionFn,
+	})
+}
+
+// flush is the M3DBTAPTable's TAPWriteMempoolFlushFn: it hands the
+// buffered, series-grouped entries to BoostSession in one batched call, so
+// symbol table lookups are amortized per series rather than paid again for
+// every datapoint.
+func (t *M3DBTAPTable) flush(entries []tapWriteMempoolEntry) {
+	writes := make([]TAPWrite, len(entries))
+	for i, entry := range entries {
+		writes[i] = TAPWrite{
+			ID:         entry.id,
+			Attributes: entry.attributes,
+			T:          entry.timestamp,
+			Value:      entry.value,
+			Unit:       entry.unit,
+		}
+	}
+
+	t.session.WriteBatchWithTaggedAttributes(t.namespace, writes, func(results []error) {
+		for i, err := range results {
+			entries[i].completionFn(err)
+		}
+	})
 }
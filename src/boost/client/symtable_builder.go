@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"errors"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/m3db/m3/src/boost/core"
 	"github.com/m3db/m3/src/dbnode/client"
 	"github.com/m3db/m3/src/x/ident"
@@ -24,8 +25,23 @@ const (
 
 	// End Dictionary
 	EndSymTable
+
+	// Carries a trained Zstd dictionary that compressed records further down
+	// the stream were encoded against. Always written immediately after
+	// InitSymTable so a consumer reading from the beginning of the stream can
+	// decompress every record without any out-of-band state.
+	SetCompressionDictionary
+
+	// Tombstone a previously written attribute value
+	DeleteAttributeValue
 )
 
+// c_CompressionFlag, when set in the upper 32 bits of a record's flags
+// uint64, marks the record's body (the bytes following the 16 byte header)
+// as Zstd-compressed. Records with the bit clear are read exactly as before,
+// so previously written streams remain valid.
+const c_CompressionFlag uint64 = 1 << 32
+
 type AttributeInstructionParams struct {
 	attributeName string
 	encodingType  core.AttributeEncoding
@@ -44,13 +60,169 @@ type Instruction struct {
 
 type SymTableBuilder struct {
 	streamPrefix string
+
+	// Pre-trained Zstd dictionary used to decode SetCompressionDictionary
+	// records as well as any compressed record read before one has been
+	// encountered in the stream being scanned.
+	zstdDictionary []byte
+	zstdDecoder    *zstd.Decoder
+
+	// Optional cache of previously built symbol tables, keyed by (name,
+	// version), so BuildSymTable only has to scan the tail of the stream
+	// rather than rescan it in full.
+	cache SymTableCache
+}
+
+// SymTableBuilderOption configures optional behavior of a SymTableBuilder.
+type SymTableBuilderOption func(*SymTableBuilder)
+
+// WithZstdDictionary configures the builder with a pre-trained Zstd
+// dictionary, e.g. one trained from a sample of historical dictValues such
+// as hostnames or service names. Individual instruction blobs are small, so
+// a shared trained dictionary dramatically improves compression ratio
+// compared to per-block Zstd.
+func WithZstdDictionary(dictionary []byte) SymTableBuilderOption {
+	return func(stb *SymTableBuilder) {
+		stb.zstdDictionary = dictionary
+	}
 }
 
-func NewSymTableBuilder() *SymTableBuilder {
-	return &SymTableBuilder{streamPrefix: "m3_metrics_symtable"}
+// WithSymTableCache configures the builder to consult cache before scanning
+// the full symbol table stream, and to keep it updated as new instructions
+// are applied.
+func WithSymTableCache(cache SymTableCache) SymTableBuilderOption {
+	return func(stb *SymTableBuilder) {
+		stb.cache = cache
+	}
+}
+
+func NewSymTableBuilder(opts ...SymTableBuilderOption) *SymTableBuilder {
+	stb := &SymTableBuilder{streamPrefix: "m3_metrics_symtable"}
+	for _, opt := range opts {
+		opt(stb)
+	}
+	return stb
+}
+
+// decompress returns the decoded payload for a record whose compression bit
+// is set. The decoder is created lazily, on the first compressed record, so
+// a stream that never carries a compressed record doesn't pay for a decoder
+// it never uses.
+func (stb *SymTableBuilder) decompress(raw []byte) ([]byte, error) {
+	if stb.zstdDecoder == nil {
+		var opts []zstd.DOption
+		if len(stb.zstdDictionary) > 0 {
+			opts = append(opts, zstd.WithDecoderDicts(stb.zstdDictionary))
+		}
+		decoder, err := zstd.NewReader(nil, opts...)
+		if err != nil {
+			return nil, err
+		}
+		stb.zstdDecoder = decoder
+	}
+	return stb.zstdDecoder.DecodeAll(raw, nil)
 }
 
-// Scans the m3db and builds the SymTable
+// recordOutcome describes what happened when a single raw instruction
+// record was applied to a SymTable being built.
+type recordOutcome int
+
+const (
+	// The record was applied to the symbol table being built.
+	outcomeApplied recordOutcome = iota
+
+	// A fresh InitSymTable for the requested version was seen; the caller
+	// must discard whatever it had built so far and start over.
+	outcomeRestart
+
+	// EndSymTable was seen; the symbol table being built is complete.
+	outcomeDone
+
+	// The record's body could not be parsed (a torn or corrupt write).
+	// The caller should restart the same way it would for outcomeRestart.
+	outcomeCorrupt
+
+	// An InitSymTable for a different version than requested was seen in a
+	// position where that should be impossible. This aborts the scan.
+	outcomeFatal
+)
+
+// applyRecord decodes raw (and decompresses it if the compression bit is
+// set) and applies it to symTable. It is used both for a live scan of the
+// m3db stream and to replay a cached snapshot's records.
+func (stb *SymTableBuilder) applyRecord(
+	symTable *core.SymTable,
+	version uint64,
+	raw []byte) (recordOutcome, error) {
+
+	if len(raw) < 16 {
+		return outcomeCorrupt, errors.New("invalid symbol table data")
+	}
+
+	flags := binary.LittleEndian.Uint64(raw)
+	v := binary.LittleEndian.Uint64(raw[8:])
+	instruction := flags & 0xFFFFFFFF
+	compressed := flags&c_CompressionFlag != 0
+
+	body := raw[16:]
+	if compressed && instruction != uint64(InitSymTable) {
+		decoded, err := stb.decompress(body)
+		if err != nil {
+			return outcomeCorrupt, err
+		}
+		body = decoded
+	}
+
+	switch instruction {
+	case uint64(InitSymTable):
+		// The symtable we read was not complete. We need to restart the
+		// build of symtable from THIS point onwards. This usually happens
+		// if the symtable was not fully written to the stream
+		if v == version {
+			return outcomeRestart, nil
+		}
+		// Something really bad happened
+		return outcomeFatal, errors.New("symbol table with version " + string(v) + " found when expecting version " + string(version))
+
+	case uint64(SetCompressionDictionary):
+		// Trained Zstd dictionary shared by every compressed record that
+		// follows it in the stream.
+		stb.zstdDictionary = body
+		stb.zstdDecoder = nil
+		return outcomeApplied, nil
+
+	case uint64(UpdateSymTable):
+		instrParams, err := stb.parseDictionaryInstructionParams(body)
+		if err != nil {
+			return outcomeCorrupt, err
+		}
+		if err := symTable.UpdateDictionary(instrParams.dictValues, nil); err != nil {
+			return outcomeCorrupt, err
+		}
+		return outcomeApplied, nil
+
+	case uint64(AddAttribute):
+		instrParams, err := stb.parseAddAttributeInstructionParams(body)
+		if err != nil {
+			return outcomeCorrupt, err
+		}
+		if err := symTable.InsertAttributeIndices(instrParams.attributeName, instrParams.indexValues, nil); err != nil {
+			return outcomeCorrupt, err
+		}
+		return outcomeApplied, nil
+
+	case uint64(EndSymTable):
+		return outcomeDone, nil
+	}
+
+	return outcomeApplied, nil
+}
+
+// Scans the m3db and builds the SymTable. If the builder was configured
+// with WithSymTableCache, a previously cached snapshot for (name, version)
+// is hydrated first and only the tail of the stream (from the snapshot's
+// watermark onwards) is scanned, rather than the full [timeBegin, timeEnd]
+// range.
 func (stb *SymTableBuilder) BuildSymTable(
 	session client.Session,
 	namespaceId ident.ID,
@@ -60,101 +232,119 @@ func (stb *SymTableBuilder) BuildSymTable(
 	timeBegin xtime.UnixNano,
 	timeEnd xtime.UnixNano) (*core.SymTable, error) {
 
+	symTable := core.NewSymTable(name, uint16(version), nil)
+	fetchBegin := timeBegin
+	haveInit := false
+	var cachedRecords [][]byte
+
+	if stb.cache != nil {
+		if snapshot, ok := stb.cache.Get(name, version); ok {
+			hydrated, err := stb.hydrateSnapshot(name, version, snapshot)
+			if err != nil {
+				// Stale or corrupt snapshot: discard it and rebuild from
+				// scratch instead of failing the fetch.
+				stb.cache.Invalidate(name, version)
+			} else {
+				symTable = hydrated
+				fetchBegin = snapshot.Watermark + 1
+				haveInit = true
+				cachedRecords = snapshot.Records
+			}
+		}
+	}
+
 	seriesID := ident.StringID(stb.streamName(name, tagsIt))
-	seriesIter, err := session.Fetch(namespaceId, seriesID, timeBegin, timeEnd)
+	seriesIter, err := session.Fetch(namespaceId, seriesID, fetchBegin, timeEnd)
 	if err != nil {
 		return nil, errors.New("unable to fetch the symbol table stream")
 	}
 
-	for seriesIter.Next() {
-		_, _, raw := seriesIter.Current()
-		if len(raw) < 16 {
-			return nil, errors.New("invalid symbol table data")
-		}
-		flags := binary.LittleEndian.Uint64(raw)
-		v := binary.LittleEndian.Uint64(raw[8:])
-		instruction := flags & 0xFFFFFFFF
-		if instruction != uint64(InitSymTable) || version != v {
-			continue
+	var tailRecords [][]byte
+	watermark := fetchBegin
+
+	persist := func() {
+		if stb.cache == nil {
+			return
 		}
+		merged := make([][]byte, 0, len(cachedRecords)+len(tailRecords))
+		merged = append(merged, cachedRecords...)
+		merged = append(merged, tailRecords...)
+		stb.cache.Put(name, version, &SymTableCacheSnapshot{Records: merged, Watermark: watermark})
+	}
+
+	for seriesIter.Next() {
+		t, _, raw := seriesIter.Current()
 
-		// We found the Init entry matching the requested version. Build the
-		// symbol table until we find the END entry
-		symTable := core.NewSymTable(name)
-		doRestart := false
-		for seriesIter.Next() {
-			_, _, raw := seriesIter.Current()
+		if !haveInit {
+			// Skip everything until we find the Init entry matching the
+			// requested version.
 			if len(raw) < 16 {
 				return nil, errors.New("invalid symbol table data")
 			}
 			flags := binary.LittleEndian.Uint64(raw)
 			v := binary.LittleEndian.Uint64(raw[8:])
-			instruction := flags & 0xFFFFFFFF
-			switch instruction {
-			case uint64(InitSymTable):
-				// The symtable we read was not complete. We need to restart
-				// the build of symtable from THIS point onwards. This usually
-				// happens if the symtable was not fully written to the stream
-				if v == version {
-					// Restart
-					symTable = core.NewSymTable(name)
-					break
-				} else {
-					// Something really bad happened
-					return nil, errors.New("symbol table with version " + string(v) + " found when expecting version " + string(version))
-				}
-			case uint64(UpdateSymTable):
-				instrParams, err := stb.parseDictionaryInstructionParams(raw[16:])
-				if err != nil {
-					// Restart
-					doRestart = true
-					break
-				}
-				indices := make([]uint64, len(instrParams.dictValues))
-				baseIndex := uint64(symTable.NumSymbols())
-				for i := 0; i < len(instrParams.dictValues); i++ {
-					indices[i] = uint64(baseIndex)
-					baseIndex++
-				}
-				err = symTable.UpdateDictionary(indices, instrParams.dictValues)
-				if err != nil {
-					// Restart
-					doRestart = true
-					break
-				}
-
-			case uint64(AddAttribute):
-				instrParams, err := stb.parseAddAttributeInstructionParams(raw[16:])
-				if err != nil {
-					// Restart
-					doRestart = true
-					break
-				}
-				err = symTable.InsertAttributeIndices(instrParams.attributeName, instrParams.indexValues)
-				if err != nil {
-					// Restart
-					doRestart = true
-					break
-				}
-
-			case uint64(EndSymTable):
-				// Done
-				return symTable, nil
+			if flags&0xFFFFFFFF != uint64(InitSymTable) || v != version {
+				continue
 			}
+			haveInit = true
+			continue
+		}
 
-			if doRestart {
-				// We need to restart the build of symtable from the NEXT point
-				// onwards, but start when we find the next Init entry with
-				// the required version
-				doRestart = false
-				break
+		outcome, err := stb.applyRecord(symTable, version, raw)
+		switch outcome {
+		case outcomeFatal:
+			// A cached snapshot may be what led the scan here; discard it
+			// so the next build starts from scratch.
+			if stb.cache != nil {
+				stb.cache.Invalidate(name, version)
 			}
+			return nil, err
+		case outcomeRestart, outcomeCorrupt:
+			// Restart the build from this point onwards; a torn write is
+			// handled exactly like an explicit restart.
+			symTable = core.NewSymTable(name, uint16(version), nil)
+			cachedRecords = nil
+			tailRecords = tailRecords[:0]
+		case outcomeApplied:
+			tailRecords = append(tailRecords, raw)
+			watermark = t
+		case outcomeDone:
+			watermark = t
+			persist()
+			return symTable, nil
 		}
 	}
 
+	if len(tailRecords) > 0 {
+		persist()
+	}
+
 	return nil, nil
 }
 
+// hydrateSnapshot replays a cached snapshot's records onto a fresh
+// SymTable. The snapshot never contains the InitSymTable record itself
+// (only what followed it), so every record is expected to apply cleanly;
+// any failure means the snapshot is stale or corrupt and the caller should
+// fall back to a full rescan.
+func (stb *SymTableBuilder) hydrateSnapshot(
+	name string,
+	version uint64,
+	snapshot *SymTableCacheSnapshot) (*core.SymTable, error) {
+
+	symTable := core.NewSymTable(name, uint16(version), nil)
+	for _, raw := range snapshot.Records {
+		outcome, err := stb.applyRecord(symTable, version, raw)
+		if outcome != outcomeApplied {
+			if err == nil {
+				err = errors.New("unexpected instruction while hydrating cached symbol table")
+			}
+			return nil, err
+		}
+	}
+	return symTable, nil
+}
+
 // Return the fully qualified stream name for the given symtable name
 func (stb *SymTableBuilder) streamName(symTableName string, tagsIt ident.TagIterator) string {
 	seriesName := stb.streamPrefix + "_" + symTableName
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+
+	xtime "github.com/m3db/m3/src/x/time"
+)
+
+// c_SymTableCacheBucket is the single BoltDB bucket holding every cached
+// symbol table snapshot, keyed by "<name>::<version>".
+var c_SymTableCacheBucket = []byte("symtables")
+
+// SymTableCache lets SymTableBuilder avoid rescanning a symbol table stream
+// from the beginning on every BuildSymTable call. A snapshot is the ordered
+// set of records needed to reconstruct a SymTable up to watermark; on a
+// cache hit, BuildSymTable only needs to fetch the tail of the stream from
+// watermark+1 onwards.
+type SymTableCache interface {
+
+	// Get returns the cached snapshot for (name, version), if any.
+	Get(name string, version uint64) (*SymTableCacheSnapshot, bool)
+
+	// Put persists (or overwrites) the snapshot for (name, version).
+	Put(name string, version uint64, snapshot *SymTableCacheSnapshot) error
+
+	// Invalidate discards the snapshot for (name, version), e.g. after the
+	// builder detects it no longer matches the stream (an unexpected
+	// InitSymTable version mismatch).
+	Invalidate(name string, version uint64) error
+
+	// Close releases any resources held by the cache.
+	Close() error
+}
+
+// SymTableCacheSnapshot is the cached state for a single (name, version)
+// symbol table: the raw instruction records observed so far (replayed
+// through the same apply path a live scan uses) and the watermark of the
+// last instruction applied.
+type SymTableCacheSnapshot struct {
+	Records   [][]byte
+	Watermark xtime.UnixNano
+}
+
+// BoltSymTableCache is the default embedded SymTableCache implementation,
+// backed by a single BoltDB file. It's meant to be shared by every
+// concurrent reader on the same host so repeated fetches for the same
+// symbol table converge on one resident snapshot.
+type BoltSymTableCache struct {
+	db *bolt.DB
+}
+
+// NewBoltSymTableCache opens (creating if necessary) a BoltDB-backed
+// SymTableCache at path.
+func NewBoltSymTableCache(path string) (*BoltSymTableCache, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(c_SymTableCacheBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltSymTableCache{db: db}, nil
+}
+
+func (c *BoltSymTableCache) Get(name string, version uint64) (*SymTableCacheSnapshot, bool) {
+	var snapshot *SymTableCacheSnapshot
+	_ = c.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(c_SymTableCacheBucket)
+		raw := bucket.Get(cacheKey(name, version))
+		if raw == nil {
+			return nil
+		}
+		decoded, err := decodeSnapshot(raw)
+		if err != nil {
+			return nil
+		}
+		snapshot = decoded
+		return nil
+	})
+	return snapshot, snapshot != nil
+}
+
+func (c *BoltSymTableCache) Put(name string, version uint64, snapshot *SymTableCacheSnapshot) error {
+	encoded := encodeSnapshot(snapshot)
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(c_SymTableCacheBucket)
+		return bucket.Put(cacheKey(name, version), encoded)
+	})
+}
+
+func (c *BoltSymTableCache) Invalidate(name string, version uint64) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(c_SymTableCacheBucket)
+		return bucket.Delete(cacheKey(name, version))
+	})
+}
+
+func (c *BoltSymTableCache) Close() error {
+	return c.db.Close()
+}
+
+func cacheKey(name string, version uint64) []byte {
+	return []byte(fmt.Sprintf("%s::%d", name, version))
+}
+
+// encodeSnapshot serializes a snapshot as: uint64 watermark, uint32 record
+// count, then each record as a uint32 length prefix followed by its bytes.
+func encodeSnapshot(snapshot *SymTableCacheSnapshot) []byte {
+	sz := 8 + 4
+	for _, rec := range snapshot.Records {
+		sz += 4 + len(rec)
+	}
+
+	buf := make([]byte, sz)
+	ndx := 0
+	binary.LittleEndian.PutUint64(buf[ndx:], uint64(snapshot.Watermark))
+	ndx += 8
+	binary.LittleEndian.PutUint32(buf[ndx:], uint32(len(snapshot.Records)))
+	ndx += 4
+	for _, rec := range snapshot.Records {
+		binary.LittleEndian.PutUint32(buf[ndx:], uint32(len(rec)))
+		ndx += 4
+		copy(buf[ndx:], rec)
+		ndx += len(rec)
+	}
+
+	return buf
+}
+
+func decodeSnapshot(raw []byte) (*SymTableCacheSnapshot, error) {
+	if len(raw) < 12 {
+		return nil, errors.New("invalid symbol table cache entry")
+	}
+	watermark := xtime.UnixNano(binary.LittleEndian.Uint64(raw))
+	ndx := 8
+	numRecords := int(binary.LittleEndian.Uint32(raw[ndx:]))
+	ndx += 4
+
+	records := make([][]byte, numRecords)
+	for i := 0; i < numRecords; i++ {
+		if len(raw) < ndx+4 {
+			return nil, errors.New("invalid symbol table cache entry")
+		}
+		recLen := int(binary.LittleEndian.Uint32(raw[ndx:]))
+		ndx += 4
+		if len(raw) < ndx+recLen {
+			return nil, errors.New("invalid symbol table cache entry")
+		}
+		rec := make([]byte, recLen)
+		copy(rec, raw[ndx:ndx+recLen])
+		records[i] = rec
+		ndx += recLen
+	}
+
+	return &SymTableCacheSnapshot{Records: records, Watermark: watermark}, nil
+}
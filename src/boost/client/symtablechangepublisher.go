@@ -0,0 +1,73 @@
+package client
+
+import (
+	"sync/atomic"
+
+	"github.com/Shopify/sarama"
+)
+
+// SymTableChangePublisher mirrors symbol table instructions onto an external
+// change feed so consumers (query engines, downstream materializers) can
+// subscribe to dictionary evolution without polling M3DB directly.
+type SymTableChangePublisher interface {
+
+	// Publish the instruction payload for the symbol table identified by key.
+	// The value is the exact bytes already written to the series so a
+	// consumer can reuse the same decode path as the M3DB stream.
+	Publish(key string, value []byte) error
+
+	// Close releases any resources held by the publisher.
+	Close() error
+}
+
+// SaramaSymTableChangePublisher is a Sarama-backed SymTableChangePublisher
+// that publishes one Kafka message per symbol table instruction, keyed by
+// the fully qualified symbol table name.
+type SaramaSymTableChangePublisher struct {
+	producer sarama.SyncProducer
+	topic    string
+
+	numPublished atomic.Uint64
+	numFailed    atomic.Uint64
+}
+
+// NewSaramaSymTableChangePublisher returns a publisher that writes every
+// instruction to the given Kafka topic via producer.
+func NewSaramaSymTableChangePublisher(
+	producer sarama.SyncProducer,
+	topic string) *SaramaSymTableChangePublisher {
+	return &SaramaSymTableChangePublisher{
+		producer: producer,
+		topic:    topic,
+	}
+}
+
+// Publish writes a single message keyed by the symbol table name.
+func (p *SaramaSymTableChangePublisher) Publish(key string, value []byte) error {
+	_, _, err := p.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: p.topic,
+		Key:   sarama.StringEncoder(key),
+		Value: sarama.ByteEncoder(value),
+	})
+	if err != nil {
+		p.numFailed.Add(1)
+		return err
+	}
+	p.numPublished.Add(1)
+	return nil
+}
+
+// Close closes the underlying producer.
+func (p *SaramaSymTableChangePublisher) Close() error {
+	return p.producer.Close()
+}
+
+// NumPublished returns the number of messages successfully published.
+func (p *SaramaSymTableChangePublisher) NumPublished() uint64 {
+	return p.numPublished.Load()
+}
+
+// NumFailed returns the number of publish attempts that failed.
+func (p *SaramaSymTableChangePublisher) NumFailed() uint64 {
+	return p.numFailed.Load()
+}
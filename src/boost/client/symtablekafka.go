@@ -0,0 +1,298 @@
+package client
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+
+	"github.com/m3db/m3/src/boost/core"
+	"github.com/m3db/m3/src/dbnode/client"
+	"github.com/m3db/m3/src/x/ident"
+	xtime "github.com/m3db/m3/src/x/time"
+)
+
+// KafkaMirroringSymStreamWriter writes the same InitSymTable/UpdateSymTable/
+// AddAttribute/EndSymTable instructions emitted to M3DB onto a Kafka topic,
+// so external consumers (query engines, downstream materializers) can
+// subscribe to dictionary evolution without polling M3DB. The Kafka message
+// key is the fully qualified symbol table name (core.GetSymbolTableName) and
+// the value is the exact header + payload bytes written to the series, so
+// SymTableBuilder's parse helpers can be reused verbatim on the consumer
+// side.
+//
+// Kafka publish failures never block the M3DB write: a failed publish is
+// buffered and retried on the next instruction, and is reflected in Lag().
+type KafkaMirroringSymStreamWriter struct {
+	session      client.Session
+	namespace    ident.ID
+	streamId     ident.ID
+	symTableName string
+	publisher    SymTableChangePublisher
+
+	encodingSpace []byte
+	pendingKafka  []kafkaMirrorRecord
+	lag           atomic.Int64
+}
+
+type kafkaMirrorRecord struct {
+	key   string
+	value []byte
+}
+
+// NewKafkaMirroringSymStreamWriter returns a writer that mirrors every
+// instruction written to the series identified by streamId onto the given
+// publisher, keyed by symTableName (as returned by core.GetSymbolTableName).
+func NewKafkaMirroringSymStreamWriter(
+	session client.Session,
+	namespace ident.ID,
+	streamId ident.ID,
+	symTableName string,
+	publisher SymTableChangePublisher) *KafkaMirroringSymStreamWriter {
+	return &KafkaMirroringSymStreamWriter{
+		session:       session,
+		namespace:     namespace,
+		streamId:      streamId,
+		symTableName:  symTableName,
+		publisher:     publisher,
+		encodingSpace: make([]byte, 16*1024),
+	}
+}
+
+// Lag returns the number of mirrored records that are still buffered for
+// retry because a previous publish attempt failed.
+func (kw *KafkaMirroringSymStreamWriter) Lag() int64 {
+	return kw.lag.Load()
+}
+
+func (kw *KafkaMirroringSymStreamWriter) WriteInitInstruction(
+	version uint16,
+	attributeValues []string,
+	completionFn core.WriteCompletionFn) error {
+	return kw.writeAndMirror(version, InitSymTable, 1, func(dst []byte) int {
+		return kw.encodeAttributeValues(dst, attributeValues)
+	}, completionFn)
+}
+
+func (kw *KafkaMirroringSymStreamWriter) WriteUpdateInstruction(
+	version uint16,
+	sequenceNum uint32,
+	attributeValues []string,
+	completionFn core.WriteCompletionFn) error {
+	return kw.writeAndMirror(version, UpdateSymTable, sequenceNum, func(dst []byte) int {
+		return kw.encodeAttributeValues(dst, attributeValues)
+	}, completionFn)
+}
+
+func (kw *KafkaMirroringSymStreamWriter) WriteAttributeInstruction(
+	version uint16,
+	sequenceNum uint32,
+	attributeName string,
+	encodingType core.AttributeEncoding,
+	indexValues []uint64,
+	completionFn core.WriteCompletionFn) error {
+	return kw.writeAndMirror(version, AddAttribute, sequenceNum, func(dst []byte) int {
+		ndx := 0
+		binary.LittleEndian.PutUint16(dst[ndx:], uint16(len(attributeName)))
+		ndx += 2
+		copy(dst[ndx:], []byte(attributeName))
+		ndx += len(attributeName)
+		binary.LittleEndian.PutUint16(dst[ndx:], uint16(encodingType))
+		ndx += 2
+		binary.LittleEndian.PutUint32(dst[ndx:], uint32(len(indexValues)))
+		ndx += 4
+		for _, v := range indexValues {
+			binary.LittleEndian.PutUint64(dst[ndx:], v)
+			ndx += 8
+		}
+		return ndx
+	}, completionFn)
+}
+
+func (kw *KafkaMirroringSymStreamWriter) WriteEndInstruction(
+	version uint16,
+	sequenceNum uint32,
+	completionFn core.WriteCompletionFn) error {
+	return kw.writeAndMirror(version, EndSymTable, sequenceNum, func(dst []byte) int {
+		return 0
+	}, completionFn)
+}
+
+func (kw *KafkaMirroringSymStreamWriter) WriteDeleteInstruction(
+	version uint16,
+	sequenceNum uint32,
+	attributeName string,
+	index uint64,
+	completionFn core.WriteCompletionFn) error {
+	return kw.writeAndMirror(version, DeleteAttributeValue, sequenceNum, func(dst []byte) int {
+		ndx := 0
+		binary.LittleEndian.PutUint16(dst[ndx:], uint16(len(attributeName)))
+		ndx += 2
+		copy(dst[ndx:], []byte(attributeName))
+		ndx += len(attributeName)
+		binary.LittleEndian.PutUint64(dst[ndx:], index)
+		ndx += 8
+		return ndx
+	}, completionFn)
+}
+
+// writeAndMirror writes the encoded record to M3DB synchronously (the
+// caller drives durability the same way M3DBSymStreamWriter does) and then
+// attempts to mirror it to Kafka. A failed mirror attempt is buffered for
+// the next call rather than surfaced as an error, since the Kafka feed is
+// best-effort relative to the M3DB write.
+func (kw *KafkaMirroringSymStreamWriter) writeAndMirror(
+	version uint16,
+	instruction TableInstruction,
+	sequenceNum uint32,
+	encodeBody func(dst []byte) int,
+	completionFn core.WriteCompletionFn) error {
+
+	ndx := kw.encodeHeader(kw.encodingSpace, version, instruction, sequenceNum)
+	ndx += encodeBody(kw.encodingSpace[ndx:])
+
+	encodedCopy := make([]byte, ndx)
+	copy(encodedCopy, kw.encodingSpace[:ndx])
+
+	t := xtime.Now()
+	err := kw.session.Write(kw.namespace, kw.streamId, t, 0, xtime.Millisecond, encodedCopy)
+	if completionFn != nil {
+		completionFn(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	kw.mirror(encodedCopy)
+	return nil
+}
+
+// mirror retries any previously buffered records before publishing the new
+// one, so a transient Kafka outage doesn't reorder the feed.
+func (kw *KafkaMirroringSymStreamWriter) mirror(value []byte) {
+	kw.pendingKafka = append(kw.pendingKafka, kafkaMirrorRecord{key: kw.symTableName, value: value})
+
+	remaining := kw.pendingKafka[:0]
+	for _, rec := range kw.pendingKafka {
+		if err := kw.publisher.Publish(rec.key, rec.value); err != nil {
+			remaining = append(remaining, rec)
+		}
+	}
+	kw.pendingKafka = remaining
+	kw.lag.Store(int64(len(kw.pendingKafka)))
+}
+
+func (kw *KafkaMirroringSymStreamWriter) encodeAttributeValues(dst []byte, attributeValues []string) int {
+	sz := 0
+	binary.LittleEndian.PutUint32(dst[sz:], uint32(len(attributeValues)))
+	sz += 4
+	for _, v := range attributeValues {
+		binary.LittleEndian.PutUint16(dst[sz:], uint16(len(v)))
+		sz += 2
+		copy(dst[sz:], []byte(v))
+		sz += len(v)
+	}
+	return sz
+}
+
+// encodeHeader writes the 16 byte header (flags, version) ahead of the
+// instruction body, matching the layout SymTableBuilder already knows how
+// to parse.
+func (kw *KafkaMirroringSymStreamWriter) encodeHeader(
+	dst []byte,
+	version uint16,
+	instruction TableInstruction,
+	sequenceNum uint32) int {
+
+	// Only the low 32 bits carry the instruction; the upper bits are left
+	// clear, since SymTableBuilder reads bit 32 as c_CompressionFlag.
+	flags := uint64(instruction) & 0xFFFFFFFF
+	binary.LittleEndian.PutUint64(dst, flags)
+	binary.LittleEndian.PutUint64(dst[8:], uint64(version))
+	return 16
+}
+
+// NewSymTableFromKafka replays a Kafka partition carrying a mirrored symbol
+// table stream (see KafkaMirroringSymStreamWriter) from the earliest offset
+// and applies the same restart-on-InitSymTable semantics as BuildSymTable,
+// so a fresh consumer converges to the current dictionary state without any
+// M3DB round-trip. Delivery is assumed to be at-least-once; duplicate
+// InitSymTable/AddAttribute instructions are tolerated the same way a torn
+// M3DB write is.
+func (stb *SymTableBuilder) NewSymTableFromKafka(
+	consumer SymTableKafkaConsumer,
+	name string,
+	version uint64) (*core.SymTable, error) {
+
+	symTable := core.NewSymTable(name, uint16(version), nil)
+	seen := false
+
+	for {
+		raw, ok := consumer.Next()
+		if !ok {
+			break
+		}
+		if len(raw) < 16 {
+			return nil, errors.New("invalid symbol table data")
+		}
+
+		flags := binary.LittleEndian.Uint64(raw)
+		v := binary.LittleEndian.Uint64(raw[8:])
+		instruction := flags & 0xFFFFFFFF
+
+		switch instruction {
+		case uint64(InitSymTable):
+			if v != version {
+				continue
+			}
+			// A duplicate/at-least-once redelivered Init restarts the table
+			// rather than erroring, mirroring the torn-write recovery used
+			// when reading straight from M3DB.
+			symTable = core.NewSymTable(name, uint16(version), nil)
+			seen = true
+
+		case uint64(UpdateSymTable):
+			if !seen || v != version {
+				continue
+			}
+			instrParams, err := stb.parseDictionaryInstructionParams(raw[16:])
+			if err != nil {
+				continue
+			}
+			if err := symTable.UpdateDictionary(instrParams.dictValues, nil); err != nil {
+				continue
+			}
+
+		case uint64(AddAttribute):
+			if !seen || v != version {
+				continue
+			}
+			instrParams, err := stb.parseAddAttributeInstructionParams(raw[16:])
+			if err != nil {
+				continue
+			}
+			if err := symTable.InsertAttributeIndices(
+				instrParams.attributeName, instrParams.indexValues, nil); err != nil {
+				continue
+			}
+
+		case uint64(EndSymTable):
+			if seen && v == version {
+				return symTable, nil
+			}
+		}
+	}
+
+	if !seen {
+		return nil, errors.New("unable to find InitSymTable instruction for requested version")
+	}
+
+	return symTable, nil
+}
+
+// SymTableKafkaConsumer abstracts the underlying Kafka client so
+// NewSymTableFromKafka doesn't need to take a dependency on a specific
+// consumer group implementation. Next returns false once the partition has
+// been fully drained up to the point the caller considers "live".
+type SymTableKafkaConsumer interface {
+	Next() (raw []byte, ok bool)
+}
@@ -0,0 +1,241 @@
+package client
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/m3db/m3/src/boost/core"
+	"github.com/m3db/m3/src/x/ident"
+	xtime "github.com/m3db/m3/src/x/time"
+)
+
+// c_TAPWriteEntryOverheadBytes is the fixed size charged per buffered entry
+// for MaxBufferBytes accounting, approximating its id, timestamp, value and
+// unit. The bytes behind an entry's attribute iterator are not counted.
+const c_TAPWriteEntryOverheadBytes = 64
+
+// tapWriteMempoolEntry is a single buffered datapoint awaiting flush.
+type tapWriteMempoolEntry struct {
+	seriesKey    string
+	id           ident.ID
+	attributes   ident.TagIterator
+	timestamp    xtime.UnixNano
+	value        float64
+	unit         xtime.Unit
+	completionFn core.TAPWriteCompletionFn
+}
+
+// TAPWriteMempoolConfig configures the intermediate write buffer
+// TAPWriteMempool drains through, analogous to a mempool sitting between a
+// trie and its backing store.
+type TAPWriteMempoolConfig struct {
+
+	// MaxBufferBytes is the approximate size (bytes) of buffered, not yet
+	// flushed datapoints that triggers an immediate flush. Zero disables
+	// this trigger (only MaxBatchSize/FlushInterval apply).
+	MaxBufferBytes uint64
+
+	// MaxBatchSize is the number of buffered datapoints that triggers an
+	// immediate flush, regardless of MaxBufferBytes.
+	MaxBatchSize int
+
+	// FlushInterval is the maximum time a datapoint waits in the buffer
+	// before being flushed, even if neither threshold above has been hit.
+	FlushInterval time.Duration
+
+	// MaxPending bounds the number of datapoints admitted before Submit
+	// blocks, replacing the old busy-wait backpressure with a real
+	// admission semaphore.
+	MaxPending int
+}
+
+// TAPWriteMempoolFlushFn flushes a batch of buffered datapoints downstream.
+// Entries are grouped by series key so a flusher can amortize per-series
+// work (e.g. symbol table lookups), as M3DBTAPTable's flush does through
+// BoostSession.WriteBatchWithTaggedAttributes. That call still issues one
+// underlying session write per datapoint, so a series' entries are not
+// collapsed into a single network call.
+type TAPWriteMempoolFlushFn func(entries []tapWriteMempoolEntry)
+
+// TAPWriteMempool buffers datapoints for M3DBTAPTable.WriteTagged and
+// drains them on a background flusher, either when the buffer crosses a
+// size/count threshold or FlushInterval elapses, whichever comes first.
+// Admission is governed by a bounded channel + semaphore, so producers
+// block on a real signal instead of spin-sleeping on an atomic counter.
+type TAPWriteMempool struct {
+	config TAPWriteMempoolConfig
+	flush  TAPWriteMempoolFlushFn
+
+	admission chan struct{}
+	incoming  chan tapWriteMempoolEntry
+
+	mu          sync.Mutex
+	buffer      []tapWriteMempoolEntry
+	bufferBytes uint64
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	wg        sync.WaitGroup
+
+	buffered atomic.Uint64
+	flushed  atomic.Uint64
+	dropped  atomic.Uint64
+}
+
+// NewTAPWriteMempool starts a TAPWriteMempool's background flusher. flush
+// is invoked from the flusher goroutine and must not block indefinitely.
+func NewTAPWriteMempool(config TAPWriteMempoolConfig, flush TAPWriteMempoolFlushFn) *TAPWriteMempool {
+	if config.MaxBatchSize <= 0 {
+		config.MaxBatchSize = 256
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 10 * time.Millisecond
+	}
+	if config.MaxPending <= 0 {
+		config.MaxPending = 4096
+	}
+
+	p := &TAPWriteMempool{
+		config:    config,
+		flush:     flush,
+		admission: make(chan struct{}, config.MaxPending),
+		incoming:  make(chan tapWriteMempoolEntry, config.MaxPending),
+		closed:    make(chan struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.run()
+
+	return p
+}
+
+// Submit admits a datapoint into the mempool, blocking on the admission
+// semaphore if MaxPending datapoints are already admitted but not yet moved
+// into the buffer by the flusher (see append).
+// Returns false (and bumps Dropped) if the mempool has been closed.
+func (p *TAPWriteMempool) Submit(entry tapWriteMempoolEntry) bool {
+	select {
+	case <-p.closed:
+		p.dropped.Add(1)
+		return false
+	case p.admission <- struct{}{}:
+	}
+
+	select {
+	case p.incoming <- entry:
+		p.buffered.Add(1)
+		return true
+	case <-p.closed:
+		<-p.admission
+		p.dropped.Add(1)
+		return false
+	}
+}
+
+// Buffered returns the total number of datapoints ever admitted.
+func (p *TAPWriteMempool) Buffered() uint64 { return p.buffered.Load() }
+
+// Flushed returns the total number of datapoints handed to flush so far.
+func (p *TAPWriteMempool) Flushed() uint64 { return p.flushed.Load() }
+
+// Dropped returns the total number of datapoints rejected because the
+// mempool had already been closed.
+func (p *TAPWriteMempool) Dropped() uint64 { return p.dropped.Load() }
+
+// Close stops the background flusher after flushing whatever remains
+// buffered, and waits for that final flush to complete.
+func (p *TAPWriteMempool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+	})
+	p.wg.Wait()
+}
+
+func (p *TAPWriteMempool) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case entry := <-p.incoming:
+			p.append(entry)
+
+		case <-ticker.C:
+			p.flushBuffered()
+
+		case <-p.closed:
+			for {
+				select {
+				case entry := <-p.incoming:
+					p.append(entry)
+				default:
+					p.flushBuffered()
+					return
+				}
+			}
+		}
+	}
+}
+
+// append buffers entry and, if a threshold has been crossed, triggers an
+// immediate flush. The admission slot taken by Submit is released here,
+// once the entry is safely in the buffer.
+func (p *TAPWriteMempool) append(entry tapWriteMempoolEntry) {
+	p.mu.Lock()
+	p.buffer = append(p.buffer, entry)
+	p.bufferBytes += c_TAPWriteEntryOverheadBytes
+	shouldFlush := len(p.buffer) >= p.config.MaxBatchSize ||
+		(p.config.MaxBufferBytes > 0 && p.bufferBytes >= p.config.MaxBufferBytes)
+	p.mu.Unlock()
+
+	<-p.admission
+
+	if shouldFlush {
+		p.flushBuffered()
+	}
+}
+
+// flushBuffered groups the currently buffered entries by series key
+// (preserving the relative order points for the same series were
+// submitted in) and hands them to flush.
+func (p *TAPWriteMempool) flushBuffered() {
+	p.mu.Lock()
+	if len(p.buffer) == 0 {
+		p.mu.Unlock()
+		return
+	}
+	entries := p.buffer
+	p.buffer = nil
+	p.bufferBytes = 0
+	p.mu.Unlock()
+
+	grouped := groupTAPWriteEntriesBySeries(entries)
+
+	p.flushed.Add(uint64(len(entries)))
+	p.flush(grouped)
+}
+
+// groupTAPWriteEntriesBySeries reorders entries so datapoints for the same
+// series are contiguous, first-seen series first, without otherwise
+// disturbing per-series ordering.
+func groupTAPWriteEntriesBySeries(entries []tapWriteMempoolEntry) []tapWriteMempoolEntry {
+	bySeries := make(map[string][]tapWriteMempoolEntry, len(entries))
+	order := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		if _, ok := bySeries[entry.seriesKey]; !ok {
+			order = append(order, entry.seriesKey)
+		}
+		bySeries[entry.seriesKey] = append(bySeries[entry.seriesKey], entry)
+	}
+
+	grouped := make([]tapWriteMempoolEntry, 0, len(entries))
+	for _, key := range order {
+		grouped = append(grouped, bySeries[key]...)
+	}
+
+	return grouped
+}
@@ -0,0 +1,237 @@
+// Package annotation encodes/decodes the bytes BoostSession stamps onto
+// every datapoint it writes, which BoostSeriesIterator.Attributes later
+// decodes to reconstruct that datapoint's attributes from a SymTable. See
+// Annotation, Encode and Decode.
+package annotation
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/golang/snappy"
+)
+
+const (
+	// magicByte leads every annotation using the framing this package
+	// defines. Chosen to be implausible as the low byte of a legacy
+	// annotation's little-endian version field (which in practice is
+	// always small, version 1 upward) - see IsLegacy.
+	magicByte byte = 0xB5
+
+	formatVersion byte = 1
+
+	// flagCompressed marks the indexed-header field's payload as
+	// snappy-compressed.
+	flagCompressed byte = 1 << 0
+
+	fieldSymTableVersion byte = 1
+	fieldSymTableHash    byte = 2
+	fieldIndexedHeader   byte = 3
+)
+
+// Annotation is the decoded content of a boost annotation.
+type Annotation struct {
+	// SymTableVersion identifies the symbol table generation this
+	// annotation's IndexedHeader was encoded against.
+	SymTableVersion uint16
+
+	// SymTableHash is the encoding table's ContentHash at encode time, so
+	// a reader can detect a divergent/corrupted symbol table before
+	// trusting IndexedHeader against it. Zero when decoded from a legacy
+	// annotation, which predates this field.
+	SymTableHash uint64
+
+	// IndexedHeader maps each attribute column to its index in the
+	// referenced symbol table (see SymTable.GetIndexedHeader). Encode
+	// assumes every entry is non-negative, matching the guarantee
+	// BoostSession's write path already upholds by resolving missing
+	// attributes before encoding.
+	IndexedHeader []int
+}
+
+// EncodeOptions controls how Encode frames an Annotation.
+type EncodeOptions struct {
+	// Compress snappy-compresses the indexed-header payload. Worth
+	// enabling once IndexedHeader is large enough that the snappy framing
+	// overhead pays for itself - this package doesn't decide that for the
+	// caller.
+	Compress bool
+}
+
+// Encode frames a into this package's TLV format: a magic byte and format
+// version, a flags byte, then one TLV field for each Annotation field
+// (SymTableVersion, SymTableHash, IndexedHeader), written even when zero or
+// empty.
+func Encode(a Annotation, opts EncodeOptions) []byte {
+	headerPayload := encodeIndexedHeader(a.IndexedHeader)
+
+	var flags byte
+	if opts.Compress && len(headerPayload) > 0 {
+		headerPayload = snappy.Encode(nil, headerPayload)
+		flags |= flagCompressed
+	}
+
+	buf := make([]byte, 0, 16+len(headerPayload))
+	buf = append(buf, magicByte, formatVersion, flags)
+	buf = appendField(buf, fieldSymTableVersion, appendUvarint(nil, uint64(a.SymTableVersion)))
+	buf = appendField(buf, fieldSymTableHash, appendUvarint(nil, a.SymTableHash))
+	buf = appendField(buf, fieldIndexedHeader, headerPayload)
+
+	return buf
+}
+
+// Decode parses raw into an Annotation. Annotations without this package's
+// magic byte are assumed to be the legacy fixed layout (2 bytes version, 2
+// bytes indexed-header size, then size*4 bytes of little-endian uint32
+// indices) predating this format, and are decoded as such for backward
+// compatibility. Returns an error - rather than panicking - on any
+// truncated or malformed input.
+func Decode(raw []byte) (Annotation, error) {
+	if IsLegacy(raw) {
+		return decodeLegacy(raw)
+	}
+	return decodeTLV(raw)
+}
+
+// IsLegacy reports whether raw predates this package's framing.
+func IsLegacy(raw []byte) bool {
+	return len(raw) < 3 || raw[0] != magicByte || raw[1] != formatVersion
+}
+
+func decodeTLV(raw []byte) (Annotation, error) {
+	var a Annotation
+	var headerPayload []byte
+	flags := raw[2]
+	pos := 3
+
+	for pos < len(raw) {
+		tag := raw[pos]
+		pos++
+
+		length, n := binary.Uvarint(raw[pos:])
+		if n <= 0 {
+			return Annotation{}, errors.New("annotation: truncated field length")
+		}
+		pos += n
+
+		if length > uint64(len(raw)-pos) {
+			return Annotation{}, errors.New("annotation: truncated field value")
+		}
+		value := raw[pos : pos+int(length)]
+		pos += int(length)
+
+		switch tag {
+		case fieldSymTableVersion:
+			v, err := decodeUvarintField(value)
+			if err != nil {
+				return Annotation{}, fmt.Errorf("annotation: symtable version field: %w", err)
+			}
+			a.SymTableVersion = uint16(v)
+
+		case fieldSymTableHash:
+			v, err := decodeUvarintField(value)
+			if err != nil {
+				return Annotation{}, fmt.Errorf("annotation: symtable hash field: %w", err)
+			}
+			a.SymTableHash = v
+
+		case fieldIndexedHeader:
+			headerPayload = value
+
+			// Unknown tags are skipped, preserving forward compatibility
+			// with annotations carrying fields this decoder predates.
+		}
+	}
+
+	if headerPayload != nil {
+		if flags&flagCompressed != 0 {
+			decoded, err := snappy.Decode(nil, headerPayload)
+			if err != nil {
+				return Annotation{}, fmt.Errorf("annotation: snappy decode: %w", err)
+			}
+			headerPayload = decoded
+		}
+
+		header, err := decodeIndexedHeader(headerPayload)
+		if err != nil {
+			return Annotation{}, err
+		}
+		a.IndexedHeader = header
+	}
+
+	return a, nil
+}
+
+func decodeLegacy(raw []byte) (Annotation, error) {
+	if len(raw) < 4 {
+		return Annotation{}, errors.New("annotation: truncated legacy header")
+	}
+
+	version := binary.LittleEndian.Uint16(raw)
+	size := int(binary.LittleEndian.Uint16(raw[2:]))
+	if len(raw) < 4+4*size {
+		return Annotation{}, errors.New("annotation: truncated legacy indexed header")
+	}
+
+	header := make([]int, size)
+	tmp := raw[4:]
+	for i := range header {
+		header[i] = int(binary.LittleEndian.Uint32(tmp[i*4:]))
+	}
+
+	return Annotation{SymTableVersion: version, IndexedHeader: header}, nil
+}
+
+func encodeIndexedHeader(header []int) []byte {
+	buf := appendUvarint(nil, uint64(len(header)))
+	for _, idx := range header {
+		buf = appendUvarint(buf, uint64(idx))
+	}
+	return buf
+}
+
+func decodeIndexedHeader(raw []byte) ([]int, error) {
+	count, n := binary.Uvarint(raw)
+	if n <= 0 {
+		return nil, errors.New("annotation: malformed indexed header count")
+	}
+	raw = raw[n:]
+	// Every entry takes at least one byte, so a count larger than what's
+	// left is malformed - reject it before allocating.
+	if count > uint64(len(raw)) {
+		return nil, errors.New("annotation: truncated indexed header")
+	}
+
+	header := make([]int, count)
+	for i := range header {
+		v, n := binary.Uvarint(raw)
+		if n <= 0 {
+			return nil, errors.New("annotation: truncated indexed header")
+		}
+		header[i] = int(v)
+		raw = raw[n:]
+	}
+
+	return header, nil
+}
+
+func decodeUvarintField(raw []byte) (uint64, error) {
+	v, n := binary.Uvarint(raw)
+	if n <= 0 || n != len(raw) {
+		return 0, errors.New("malformed varint")
+	}
+	return v, nil
+}
+
+func appendField(buf []byte, tag byte, payload []byte) []byte {
+	buf = append(buf, tag)
+	buf = appendUvarint(buf, uint64(len(payload)))
+	return append(buf, payload...)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
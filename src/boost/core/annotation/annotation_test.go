@@ -0,0 +1,77 @@
+package annotation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotationRoundTrip(t *testing.T) {
+	a := Annotation{
+		SymTableVersion: 3,
+		SymTableHash:    0xDEADBEEF,
+		IndexedHeader:   []int{0, 1, 2, 7},
+	}
+
+	raw := Encode(a, EncodeOptions{})
+	require.False(t, IsLegacy(raw))
+
+	decoded, err := Decode(raw)
+	require.NoError(t, err)
+	require.Equal(t, a, decoded)
+}
+
+func TestAnnotationRoundTripCompressed(t *testing.T) {
+	a := Annotation{
+		SymTableVersion: 1,
+		SymTableHash:    42,
+		IndexedHeader:   []int{0, 0, 0, 0, 1, 1, 1, 1},
+	}
+
+	raw := Encode(a, EncodeOptions{Compress: true})
+	decoded, err := Decode(raw)
+	require.NoError(t, err)
+	require.Equal(t, a, decoded)
+}
+
+func TestAnnotationEmptyIndexedHeader(t *testing.T) {
+	a := Annotation{SymTableVersion: 1}
+	raw := Encode(a, EncodeOptions{})
+
+	decoded, err := Decode(raw)
+	require.NoError(t, err)
+	require.Equal(t, uint16(1), decoded.SymTableVersion)
+	require.Equal(t, 0, len(decoded.IndexedHeader))
+}
+
+func TestAnnotationLegacyLayout(t *testing.T) {
+	// 2 bytes version, 2 bytes size, then size*4 bytes of uint32 indices -
+	// the layout BoostSession wrote before this package existed.
+	raw := []byte{2, 0, 3, 0, 5, 0, 0, 0, 6, 0, 0, 0, 7, 0, 0, 0}
+	require.True(t, IsLegacy(raw))
+
+	decoded, err := Decode(raw)
+	require.NoError(t, err)
+	require.Equal(t, uint16(2), decoded.SymTableVersion)
+	require.Equal(t, []int{5, 6, 7}, decoded.IndexedHeader)
+	require.Equal(t, uint64(0), decoded.SymTableHash)
+}
+
+func TestAnnotationTruncated(t *testing.T) {
+	a := Annotation{SymTableVersion: 1, IndexedHeader: []int{0, 1, 2}}
+	raw := Encode(a, EncodeOptions{})
+
+	_, err := Decode(raw[:len(raw)-1])
+	require.Error(t, err)
+
+	_, err = Decode(raw[:2])
+	require.Error(t, err)
+}
+
+func TestAnnotationLegacyTruncated(t *testing.T) {
+	_, err := Decode([]byte{1, 0, 2, 0, 1, 0})
+	require.Error(t, err)
+
+	_, err = Decode([]byte{1, 0})
+	require.Error(t, err)
+}
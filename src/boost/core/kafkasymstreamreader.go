@@ -0,0 +1,186 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/Shopify/sarama"
+	xtime "github.com/m3db/m3/src/x/time"
+)
+
+// Reads a symbol table instruction log back from the Kafka topic a
+// KafkaSymStreamWriter produced to, with the same Seek/Next/Read* methods as
+// SymStreamReader. It has no Follow method, so it does not satisfy the
+// SymStreamReader interface. Only the single
+// partition streamId hashes to (see kafkaPartitionForKey) is consumed, since
+// that's the only partition the writer ever produced records to for this
+// stream.
+type KafkaSymStreamReader struct {
+	client   sarama.Client
+	consumer sarama.Consumer
+	topic    string
+	streamId string
+
+	partitionConsumer sarama.PartitionConsumer
+	endTime           xtime.UnixNano
+
+	itInstruction TableInstruction
+	itSeqNum      uint32
+	itRaw         []byte
+}
+
+func NewKafkaSymStreamReader(
+	client sarama.Client,
+	topic string,
+	streamId string) (*KafkaSymStreamReader, error) {
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KafkaSymStreamReader{
+		client:        client,
+		consumer:      consumer,
+		topic:         topic,
+		streamId:      streamId,
+		itInstruction: NOPInstruction,
+	}, nil
+}
+
+// Seek to first entry between the specified start and end time in the
+// underlying stream, translating the timestamps into offsets via
+// OffsetsForTimes on the partition streamId hashes to.
+func (kr *KafkaSymStreamReader) Seek(startTime xtime.UnixNano, endTime xtime.UnixNano) error {
+
+	partitions, err := kr.client.Partitions(kr.topic)
+	if err != nil {
+		return errors.New("unable to fetch the symbol table stream")
+	}
+	partition := kafkaPartitionForKey(kr.streamId, int32(len(partitions)))
+
+	startOffset, err := kr.client.GetOffset(kr.topic, partition, startTime.ToTime().UnixMilli())
+	if err != nil {
+		return errors.New("unable to fetch the symbol table stream")
+	}
+
+	if kr.partitionConsumer != nil {
+		_ = kr.partitionConsumer.Close()
+	}
+
+	partitionConsumer, err := kr.consumer.ConsumePartition(kr.topic, partition, startOffset)
+	if err != nil {
+		return errors.New("unable to fetch the symbol table stream")
+	}
+
+	kr.partitionConsumer = partitionConsumer
+	kr.endTime = endTime
+	kr.itSeqNum = 0
+
+	return nil
+}
+
+// Read the next instruction from the stream and return the version,
+// sequence number and the instruction. NOPInstruction is returned once a
+// message timestamped after endTime arrives or the partition consumer's
+// channels are closed; until one of those happens Next blocks waiting for
+// the next message, since a Kafka partition has no end-of-stream marker.
+// Otherwise, return error.
+func (kr *KafkaSymStreamReader) Next() (uint16, uint32, TableInstruction, error) {
+
+	select {
+	case msg, ok := <-kr.partitionConsumer.Messages():
+		if !ok {
+			return 0, 0, NOPInstruction, nil
+		}
+
+		if kr.endTime > 0 && xtime.ToUnixNano(msg.Timestamp) > kr.endTime {
+			return 0, 0, NOPInstruction, nil
+		}
+
+		header := kr.findHeader(msg.Headers)
+		if header == nil {
+			return 0, 0, NOPInstruction, errors.New("invalid symbol table data")
+		}
+
+		version, instruction, seqNum, err := decodeSymStreamHeader(header)
+		if err != nil {
+			return 0, 0, NOPInstruction, err
+		}
+
+		kr.itInstruction = instruction
+		kr.itSeqNum = seqNum
+		kr.itRaw = msg.Value
+
+		return version, seqNum, instruction, nil
+
+	case err, ok := <-kr.partitionConsumer.Errors():
+		if !ok || err == nil {
+			return 0, 0, NOPInstruction, nil
+		}
+		return 0, 0, NOPInstruction, err.Err
+	}
+}
+
+// Read InitSymTable instruction parameter from the current position in the
+// stream. If the current instruction is not InitSymTable, return error.
+func (kr *KafkaSymStreamReader) ReadInitInstruction() ([]string, error) {
+	if kr.itRaw == nil || kr.itInstruction != InitSymTable {
+		return nil, errors.New("stream not seeked to a InitSymTable instruction")
+	}
+
+	return decodeSymStreamDictionaryParams(kr.itRaw)
+}
+
+// Read UpdateSymTable instruction parameter from the current position in
+// the stream. If the current instruction is not UpdateSymTable, return
+// error.
+func (kr *KafkaSymStreamReader) ReadUpdateInstruction() ([]string, error) {
+	if kr.itRaw == nil || kr.itInstruction != UpdateSymTable {
+		return nil, errors.New("stream not seeked to a UpdateSymTable instruction")
+	}
+
+	return decodeSymStreamDictionaryParams(kr.itRaw)
+}
+
+// Read AddAttribute instruction parameter from the current position in
+// the stream. If the current instruction is not AddAttribute, return
+// error.
+func (kr *KafkaSymStreamReader) ReadAttributeInstruction() (string, AttributeEncoding, []uint64, error) {
+	if kr.itRaw == nil || kr.itInstruction != AddAttribute {
+		return "", 0, nil, errors.New("stream not seeked to a AddAttribute instruction")
+	}
+
+	return decodeSymStreamAddAttributeParams(kr.itRaw)
+}
+
+// Read the EndSymTable instruction from the stream at the current location
+// of the underlying stream. EndSymTable carries no body, so the name and
+// value list are always empty.
+func (kr *KafkaSymStreamReader) ReadEndInstruction() (string, []uint64, error) {
+	if kr.itRaw == nil || kr.itInstruction != EndSymTable {
+		return "", nil, errors.New("stream not seeked to a EndSymTable instruction")
+	}
+
+	return "", nil, nil
+}
+
+// Read DeleteAttributeValue instruction parameters from the current
+// position in the stream: the attribute name and the tombstoned dictionary
+// index. If the current instruction is not DeleteAttributeValue, return
+// error.
+func (kr *KafkaSymStreamReader) ReadDeleteInstruction() (string, uint64, error) {
+	if kr.itRaw == nil || kr.itInstruction != DeleteAttributeValue {
+		return "", 0, errors.New("stream not seeked to a DeleteAttributeValue instruction")
+	}
+
+	return decodeSymStreamDeleteParams(kr.itRaw)
+}
+
+func (kr *KafkaSymStreamReader) findHeader(headers []*sarama.RecordHeader) []byte {
+	for _, h := range headers {
+		if string(h.Key) == c_SymStreamHeaderKey {
+			return h.Value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"errors"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	xtime "github.com/m3db/m3/src/x/time"
+)
+
+// Implements the SymStreamWriter to write the symbol table instruction log
+// onto a Kafka topic instead of an m3db time series. Every instruction for
+// a given stream is produced with the same partition key (streamId), so
+// Kafka's key-based partitioning keeps one stream confined to a single
+// partition and therefore in order; the 8 byte instruction header (version,
+// instruction, sequence number) is carried as a message header so consumers
+// can filter without decoding the TLV body.
+type KafkaSymStreamWriter struct {
+	topic         string
+	streamId      string
+	producer      sarama.SyncProducer
+	encodingSpace []byte
+	pendingWrites atomic.Int32
+}
+
+// c_SymStreamHeaderKey is the Kafka record header carrying the 8 byte
+// instruction header.
+const c_SymStreamHeaderKey = "symstream-header"
+
+func NewKafkaSymStreamWriter(
+	producer sarama.SyncProducer,
+	topic string,
+	streamId string) *KafkaSymStreamWriter {
+	// At most 16k worth of instruction info could written into a
+	// single message. TODO: This needs to be in-syn with the m3db limits
+	// on the size of annotations
+	ret := &KafkaSymStreamWriter{
+		topic:         topic,
+		streamId:      streamId,
+		producer:      producer,
+		encodingSpace: make([]byte, 16*1024),
+	}
+	ret.pendingWrites.Store(0)
+	return ret
+}
+
+func (kw *KafkaSymStreamWriter) WriteInitInstruction(
+	version uint16,
+	attributeValues []string,
+	completionFn WriteCompletionFn) error {
+	return kw.writeInstruction(version, InitSymTable, 1, func(dst []byte) int {
+		return encodeSymStreamAttributeValues(dst, attributeValues)
+	}, completionFn)
+}
+
+func (kw *KafkaSymStreamWriter) WriteUpdateInstruction(
+	version uint16,
+	sequenceNum uint32,
+	attributeValues []string,
+	completionFn WriteCompletionFn) error {
+	return kw.writeInstruction(version, UpdateSymTable, sequenceNum, func(dst []byte) int {
+		return encodeSymStreamAttributeValues(dst, attributeValues)
+	}, completionFn)
+}
+
+func (kw *KafkaSymStreamWriter) WriteAttributeInstruction(
+	version uint16,
+	sequenceNum uint32,
+	attributeName string,
+	encodingType AttributeEncoding,
+	indexValues []uint64,
+	completionFn WriteCompletionFn) error {
+	return kw.writeInstruction(version, AddAttribute, sequenceNum, func(dst []byte) int {
+		return encodeSymStreamAttributeInstruction(dst, attributeName, encodingType, indexValues)
+	}, completionFn)
+}
+
+func (kw *KafkaSymStreamWriter) WriteEndInstruction(
+	version uint16,
+	sequenceNum uint32,
+	completionFn WriteCompletionFn) error {
+	return kw.writeInstruction(version, EndSymTable, sequenceNum, func(dst []byte) int {
+		return 0
+	}, completionFn)
+}
+
+func (kw *KafkaSymStreamWriter) WriteDeleteInstruction(
+	version uint16,
+	sequenceNum uint32,
+	attributeName string,
+	index uint64,
+	completionFn WriteCompletionFn) error {
+	return kw.writeInstruction(version, DeleteAttributeValue, sequenceNum, func(dst []byte) int {
+		return encodeSymStreamDeleteInstruction(dst, attributeName, index)
+	}, completionFn)
+}
+
+// writeInstruction encodes the header and body, then asynchronously produces
+// the record, mirroring the fire-and-forget + pendingWrites bookkeeping used
+// by M3DBSymStreamWriter so Wait(timeout) behaves the same way regardless of
+// which backend the caller picked.
+func (kw *KafkaSymStreamWriter) writeInstruction(
+	version uint16,
+	instruction TableInstruction,
+	sequenceNum uint32,
+	encodeBody func(dst []byte) int,
+	completionFn WriteCompletionFn) error {
+
+	header := make([]byte, 8)
+	hdrSz := encodeSymStreamHeader(header, version, instruction, sequenceNum)
+	if hdrSz <= 0 {
+		return errors.New("unable to write instruction header to the stream")
+	}
+
+	bodySz := encodeBody(kw.encodingSpace)
+	encodedCopy := make([]byte, bodySz)
+	copy(encodedCopy, kw.encodingSpace[:bodySz])
+
+	// Timestamp it here (instead of the goroutine) to capture the intended
+	// chronological order of the instructions
+	t := xtime.Now()
+
+	go func(t xtime.UnixNano, header []byte, body []byte) {
+		kw.pendingWrites.Add(1)
+		_, _, err := kw.producer.SendMessage(&sarama.ProducerMessage{
+			Topic:     kw.topic,
+			Key:       sarama.StringEncoder(kw.streamId),
+			Value:     sarama.ByteEncoder(body),
+			Headers:   []sarama.RecordHeader{{Key: []byte(c_SymStreamHeaderKey), Value: header}},
+			Timestamp: t.ToTime(),
+		})
+		kw.pendingWrites.Add(-1)
+		if completionFn != nil {
+			completionFn(err)
+		}
+	}(t, header, encodedCopy)
+
+	// TODO: Updates stats
+
+	return nil
+}
+
+// Wait for all pending write operations to complete or until the specified
+// timeout is reached. If timeout is 0, wait indefinitely until all pending
+// writes are completed.
+func (kw *KafkaSymStreamWriter) Wait(timeout time.Duration) error {
+	totalUs := 0
+
+	for {
+		if kw.pendingWrites.Load() == 0 {
+			break
+		}
+		time.Sleep(100 * time.Microsecond)
+		totalUs += 100
+		if (timeout > 0) && (totalUs > int(timeout/time.Microsecond)) {
+			return errors.New("timeout waiting for pending writes to complete")
+		}
+	}
+
+	return nil
+}
+
+// kafkaPartitionForKey computes the same partition a sarama.NewHashPartitioner
+// would route streamId to for a topic with numPartitions partitions, so a
+// reader that only knows streamId (not the partition sarama chose) can find
+// the records without consuming every partition in the topic.
+func kafkaPartitionForKey(streamId string, numPartitions int32) int32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(streamId))
+	partition := int32(h.Sum32()) % numPartitions
+	if partition < 0 {
+		partition = -partition
+	}
+	return partition
+}
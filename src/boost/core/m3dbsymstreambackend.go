@@ -0,0 +1,62 @@
+package core
+
+import (
+	"github.com/m3db/m3/src/dbnode/client"
+	"github.com/m3db/m3/src/dbnode/encoding"
+	"github.com/m3db/m3/src/x/ident"
+	xtime "github.com/m3db/m3/src/x/time"
+)
+
+// m3dbBackend is the default SymStreamBackend, backed by an m3db client
+// session. M3DBSymStreamWriter/M3DBSymStreamReader are thin adapters over
+// this (or any other SymStreamBackend).
+type m3dbBackend struct {
+	session client.Session
+}
+
+func newM3DBBackend(session client.Session) *m3dbBackend {
+	return &m3dbBackend{session: session}
+}
+
+func (b *m3dbBackend) Append(
+	namespace ident.ID,
+	streamId ident.ID,
+	ts xtime.UnixNano,
+	payload []byte) error {
+	return b.session.Write(namespace, streamId, ts, 0, xtime.Millisecond, payload)
+}
+
+func (b *m3dbBackend) Scan(
+	namespace ident.ID,
+	streamId ident.ID,
+	start xtime.UnixNano,
+	end xtime.UnixNano) (SymStreamBackendIterator, error) {
+
+	seriesIt, err := b.session.Fetch(namespace, streamId, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return &m3dbBackendIterator{seriesIt: seriesIt}, nil
+}
+
+func (b *m3dbBackend) Close() error {
+	return nil
+}
+
+type m3dbBackendIterator struct {
+	seriesIt encoding.SeriesIterator
+}
+
+func (it *m3dbBackendIterator) Next() bool {
+	return it.seriesIt.Next()
+}
+
+func (it *m3dbBackendIterator) Current() []byte {
+	_, _, raw := it.seriesIt.Current()
+	return raw
+}
+
+func (it *m3dbBackendIterator) Close() {
+	it.seriesIt.Close()
+}
@@ -1,53 +1,79 @@
 package core
 
 import (
-	"encoding/binary"
+	"context"
 	"errors"
+	"time"
 
 	"github.com/m3db/m3/src/dbnode/client"
-	"github.com/m3db/m3/src/dbnode/encoding"
 	"github.com/m3db/m3/src/x/ident"
 	xtime "github.com/m3db/m3/src/x/time"
 )
 
-// Implements the SymStreamReader to read the symbol table to an m3db time series
+// c_DefaultFollowPollInterval is used by Follow when no explicit interval
+// has been configured via SetFollowPollInterval.
+const c_DefaultFollowPollInterval = 500 * time.Millisecond
+
+// Implements the SymStreamReader to read the symbol table from an m3db time
+// series. M3DBSymStreamReader is itself just a thin adapter over a
+// SymStreamBackend (an m3dbBackend by default); see
+// NewM3DBSymStreamReaderWithBackend to plug in a different one (e.g. for
+// tests).
 type M3DBSymStreamReader struct {
 	namespace     ident.ID
 	streamId      ident.ID
-	session       client.Session
-	seriesIt      encoding.SeriesIterator
+	backend       SymStreamBackend
+	backendIt     SymStreamBackendIterator
 	itInstruction TableInstruction
 	itSeqNum      uint32
 	itRaw         []byte
+
+	followPollInterval time.Duration
 }
 
 func NewM3DBSymStreamReader(namespace ident.ID, streamId ident.ID, session client.Session) *M3DBSymStreamReader {
+	return NewM3DBSymStreamReaderWithBackend(namespace, streamId, newM3DBBackend(session))
+}
+
+// NewM3DBSymStreamReaderWithBackend is the same as NewM3DBSymStreamReader
+// except it takes a SymStreamBackend directly, so callers can substitute
+// InMemorySymStreamBackend/FileSymStreamBackend instead of a real m3db
+// session.
+func NewM3DBSymStreamReaderWithBackend(
+	namespace ident.ID,
+	streamId ident.ID,
+	backend SymStreamBackend) *M3DBSymStreamReader {
 	// At most 16k worth of instruction info could read into the
 	// temporary space. TODO: This needs to be in-syn with the m3db limits
 	// on the size of annotations
 	return &M3DBSymStreamReader{
-		namespace:     namespace,
-		streamId:      streamId,
-		session:       session,
-		seriesIt:      nil,
-		itInstruction: NOPInstruction,
-		itSeqNum:      0,
-		itRaw:         nil,
+		namespace:          namespace,
+		streamId:           streamId,
+		backend:            backend,
+		backendIt:          nil,
+		itInstruction:      NOPInstruction,
+		itSeqNum:           0,
+		itRaw:              nil,
+		followPollInterval: c_DefaultFollowPollInterval,
 	}
 }
 
+// SetFollowPollInterval overrides the interval Follow polls the underlying
+// stream at for newly arrived instructions. Must be called before Follow.
+func (sr *M3DBSymStreamReader) SetFollowPollInterval(interval time.Duration) {
+	sr.followPollInterval = interval
+}
+
 // Seek to first entry between the specified start and end time in the
 // underlying stream.
 func (sr *M3DBSymStreamReader) Seek(startTime xtime.UnixNano, endTime xtime.UnixNano) error {
 
-	// Fetch the time series
-	seriesIter, err := sr.session.Fetch(
-		sr.namespace, sr.streamId, startTime, endTime)
+	backendIt, err := sr.backend.Scan(sr.namespace, sr.streamId, startTime, endTime)
 	if err != nil {
 		return errors.New("unable to fetch the symbol table stream")
 	}
 
-	sr.seriesIt = seriesIter
+	sr.backendIt = backendIt
 	sr.itSeqNum = 0
 
 	return nil
@@ -58,11 +84,11 @@ func (sr *M3DBSymStreamReader) Seek(startTime xtime.UnixNano, endTime xtime.Unix
 // returns NOPInstruction. Otherwise, return error.
 func (sr *M3DBSymStreamReader) Next() (uint16, uint32, TableInstruction, error) {
 
-	if !sr.seriesIt.Next() {
+	if !sr.backendIt.Next() {
 		return 0, 0, NOPInstruction, nil
 	}
 
-	_, _, raw := sr.seriesIt.Current()
+	raw := sr.backendIt.Current()
 	if len(raw) < 8 {
 		return 0, 0, NOPInstruction, errors.New("invalid symbol table data")
 	}
@@ -132,61 +158,217 @@ func (sr *M3DBSymStreamReader) ReadAttributeInstruction() (string, AttributeEnco
 	return attrName, encodingType, indexValues, nil
 }
 
-// Decode the instruction header from the stream
-func (sr *M3DBSymStreamReader) decodeHeader(raw []byte) (uint16, TableInstruction, uint32, error) {
+// Read the EndSymTable instruction from the stream at the current location
+// of the underlying stream. EndSymTable carries no body, so the name and
+// value list are always empty.
+func (sr *M3DBSymStreamReader) ReadEndInstruction() (string, []uint64, error) {
+	if sr.itRaw == nil || sr.itInstruction != EndSymTable {
+		return "", nil, errors.New("stream not seeked to a EndSymTable instruction")
+	}
 
-	flags := binary.LittleEndian.Uint32(raw)
-	// Decode version and instruction from flags
-	version := uint16(flags >> 16) // Upper 16 bits
-	instruction := flags & 0xFF    // Lower 8 bits
-	// Decode the sequence number
-	sequenceNum := binary.LittleEndian.Uint32(raw[4:])
+	return "", nil, nil
+}
+
+// Read DeleteAttributeValue instruction parameters from the current
+// position in the stream: the attribute name and the tombstoned dictionary
+// index. If the current instruction is not DeleteAttributeValue, return
+// error.
+func (sr *M3DBSymStreamReader) ReadDeleteInstruction() (string, uint64, error) {
 
-	if instruction >= uint32(NOPInstruction) {
-		return 0, 0, 0, errors.New("invalid instruction")
+	if sr.itRaw == nil || sr.itInstruction != DeleteAttributeValue {
+		return "", 0, errors.New("stream not seeked to a DeleteAttributeValue instruction")
 	}
 
-	return version, TableInstruction(instruction), sequenceNum, nil
+	// Ok now we got we want. Parse the instruction params
+	attrName, index, err := sr.decodeDeleteInstructionParams(sr.itRaw[8:])
+	if err != nil {
+		return "", 0, err
+	}
+
+	return attrName, index, nil
+}
+
+// Decode the instruction header from the stream
+func (sr *M3DBSymStreamReader) decodeHeader(raw []byte) (uint16, TableInstruction, uint32, error) {
+	return decodeSymStreamHeader(raw)
 }
 
 // Decode the dictionary update instruction params from the stream
 func (sr *M3DBSymStreamReader) decodeDictionaryInstructionParams(raw []byte) ([]string, error) {
-	// Decode the number of values
-	numValues := binary.LittleEndian.Uint32(raw)
-	raw = raw[4:]
-	values := make([]string, numValues)
-	for i := 0; i < int(numValues); i++ {
-		// Decode the length of the value
-		valueLen := binary.LittleEndian.Uint16(raw)
-		raw = raw[2:]
-		// Decode the value
-		values[i] = string(raw[:valueLen])
-		raw = raw[valueLen:]
-	}
-
-	return values, nil
+	return decodeSymStreamDictionaryParams(raw)
 }
 
 // Decode the add attribute instruction params from the stream
 func (sr *M3DBSymStreamReader) decodeAddAttributeInstructionParams(raw []byte) (string, AttributeEncoding, []uint64, error) {
-	// Decode the length of the attribute name
-	attrNameLen := binary.LittleEndian.Uint16(raw)
-	raw = raw[2:]
-	// Decode the attribute name
-	attrName := string(raw[:attrNameLen])
-	raw = raw[attrNameLen:]
-	// Decode the encoding type
-	encodingType := AttributeEncoding(binary.LittleEndian.Uint16(raw))
-	raw = raw[2:]
-	// Decode the number of values
-	numValues := binary.LittleEndian.Uint32(raw)
-	raw = raw[4:]
-	values := make([]uint64, numValues)
-	for i := 0; i < int(numValues); i++ {
-		// Decode the value
-		values[i] = binary.LittleEndian.Uint64(raw)
-		raw = raw[8:]
-	}
-
-	return attrName, encodingType, values, nil
+	return decodeSymStreamAddAttributeParams(raw)
+}
+
+// Decode the delete attribute value instruction params from the stream
+func (sr *M3DBSymStreamReader) decodeDeleteInstructionParams(raw []byte) (string, uint64, error) {
+	return decodeSymStreamDeleteParams(raw)
+}
+
+// Follow seeks to startTime, drains the historical instructions, then
+// re-seeks the underlying stream on an interval to pick up newly arrived
+// instructions, emitting each as a decoded Instruction until ctx is
+// cancelled. The reader doesn't surface a per-instruction timestamp, so the
+// re-seek watermark is the time Follow itself observed the instruction; the
+// overlap this produces is de-duplicated by sequence number rather than by
+// trusting the watermark to be exact.
+func (sr *M3DBSymStreamReader) Follow(
+	ctx context.Context,
+	startTime xtime.UnixNano) (<-chan Instruction, error) {
+
+	if err := sr.Seek(startTime, 0); err != nil {
+		return nil, err
+	}
+
+	interval := sr.followPollInterval
+	if interval <= 0 {
+		interval = c_DefaultFollowPollInterval
+	}
+
+	out := make(chan Instruction)
+
+	go func() {
+		defer close(out)
+
+		watermarkTime := startTime
+		var watermarkSeqNum uint32
+		seenAny := false
+
+		// drain emits every instruction available on the current backendIt.
+		// Returns false once Follow should stop altogether (ctx cancelled,
+		// a gap was detected or the underlying read failed).
+		drain := func() bool {
+			for {
+				version, seqNum, instruction, err := sr.Next()
+				if err != nil {
+					select {
+					case out <- Instruction{Err: err}:
+					case <-ctx.Done():
+					}
+					return false
+				}
+				if instruction == NOPInstruction {
+					return true
+				}
+
+				if instruction != InitSymTable && seenAny {
+					if seqNum <= watermarkSeqNum {
+						// Already emitted this instruction from the
+						// overlapping re-seek window.
+						continue
+					}
+					if seqNum != watermarkSeqNum+1 {
+						select {
+						case out <- Instruction{Err: ErrSequenceGap}:
+						case <-ctx.Done():
+						}
+						return false
+					}
+				}
+
+				instr, err := sr.decodeFollowInstruction(version, seqNum, instruction)
+				if err != nil {
+					select {
+					case out <- Instruction{Err: err}:
+					case <-ctx.Done():
+					}
+					return false
+				}
+
+				select {
+				case out <- instr:
+				case <-ctx.Done():
+					return false
+				}
+
+				watermarkSeqNum = seqNum
+				watermarkTime = xtime.Now()
+				seenAny = true
+			}
+		}
+
+		if !drain() {
+			return
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := sr.Seek(watermarkTime, 0); err != nil {
+					select {
+					case out <- Instruction{Err: err}:
+					case <-ctx.Done():
+					}
+					return
+				}
+				if !drain() {
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// decodeFollowInstruction decodes the params for the instruction Next() just
+// positioned the reader on, using the already-read sr.itRaw.
+func (sr *M3DBSymStreamReader) decodeFollowInstruction(
+	version uint16,
+	seqNum uint32,
+	instruction TableInstruction) (Instruction, error) {
+
+	switch instruction {
+	case InitSymTable, UpdateSymTable:
+		attributeValues, err := sr.decodeDictionaryInstructionParams(sr.itRaw[8:])
+		if err != nil {
+			return Instruction{}, err
+		}
+		return Instruction{
+			Version:         version,
+			SeqNum:          seqNum,
+			Kind:            instruction,
+			AttributeValues: attributeValues,
+		}, nil
+
+	case AddAttribute:
+		attrName, encodingType, indexValues, err := sr.decodeAddAttributeInstructionParams(sr.itRaw[8:])
+		if err != nil {
+			return Instruction{}, err
+		}
+		return Instruction{
+			Version:       version,
+			SeqNum:        seqNum,
+			Kind:          instruction,
+			AttributeName: attrName,
+			Encoding:      encodingType,
+			IndexValues:   indexValues,
+		}, nil
+
+	case EndSymTable:
+		return Instruction{Version: version, SeqNum: seqNum, Kind: instruction}, nil
+
+	case DeleteAttributeValue:
+		attrName, index, err := sr.decodeDeleteInstructionParams(sr.itRaw[8:])
+		if err != nil {
+			return Instruction{}, err
+		}
+		return Instruction{
+			Version:       version,
+			SeqNum:        seqNum,
+			Kind:          instruction,
+			AttributeName: attrName,
+			DeletedIndex:  index,
+		}, nil
+	}
+
+	return Instruction{}, errors.New("unknown symbol table instruction")
 }
@@ -1,7 +1,6 @@
 package core
 
 import (
-	"encoding/binary"
 	"errors"
 	"sync/atomic"
 	"time"
@@ -11,11 +10,15 @@ import (
 	xtime "github.com/m3db/m3/src/x/time"
 )
 
-// Implements the SymStreamWriter to write the symbol table to an m3db time series
+// Implements the SymStreamWriter to write the symbol table to an m3db time
+// series. M3DBSymStreamWriter is itself just a thin adapter over a
+// SymStreamBackend (an m3dbBackend by default); see
+// NewM3DBSymStreamWriterWithBackend to plug in a different one (e.g. for
+// tests).
 type M3DBSymStreamWriter struct {
 	namespace     ident.ID
 	streamId      ident.ID
-	session       client.Session
+	backend       SymStreamBackend
 	encodingSpace []byte
 	pendingWrites atomic.Int32
 }
@@ -24,13 +27,24 @@ func NewM3DBSymStreamWriter(
 	namespace ident.ID,
 	streamId ident.ID,
 	session client.Session) *M3DBSymStreamWriter {
+	return NewM3DBSymStreamWriterWithBackend(namespace, streamId, newM3DBBackend(session))
+}
+
+// NewM3DBSymStreamWriterWithBackend is the same as NewM3DBSymStreamWriter
+// except it takes a SymStreamBackend directly, so callers can substitute
+// InMemorySymStreamBackend/FileSymStreamBackend instead of a real m3db
+// session.
+func NewM3DBSymStreamWriterWithBackend(
+	namespace ident.ID,
+	streamId ident.ID,
+	backend SymStreamBackend) *M3DBSymStreamWriter {
 	// At most 16k worth of instruction info could written into a
 	// single point. TODO: This needs to be in-syn with the m3db limits
 	// on the size of annotations
 	ret := &M3DBSymStreamWriter{
 		namespace:     namespace,
 		streamId:      streamId,
-		session:       session,
+		backend:       backend,
 		encodingSpace: make([]byte, 16*1024),
 		pendingWrites: atomic.Int32{},
 	}
@@ -69,13 +83,7 @@ func (su *M3DBSymStreamWriter) WriteInitInstruction(
 
 	go func(t xtime.UnixNano, encodedData []byte) {
 		su.pendingWrites.Add(1)
-		err := su.session.Write(
-			su.namespace,
-			su.streamId,
-			t,
-			0,
-			xtime.Millisecond,
-			encodedData)
+		err := su.backend.Append(su.namespace, su.streamId, t, encodedData)
 		su.pendingWrites.Add(-1)
 		if completionFn != nil {
 			completionFn(err)
@@ -118,13 +126,7 @@ func (su *M3DBSymStreamWriter) WriteUpdateInstruction(
 
 	go func(t xtime.UnixNano, encodedData []byte) {
 		su.pendingWrites.Add(1)
-		err := su.session.Write(
-			su.namespace,
-			su.streamId,
-			t,
-			0,
-			xtime.Millisecond,
-			encodedData)
+		err := su.backend.Append(su.namespace, su.streamId, t, encodedData)
 		su.pendingWrites.Add(-1)
 		if completionFn != nil {
 			completionFn(err)
@@ -153,18 +155,7 @@ func (su *M3DBSymStreamWriter) WriteAttributeInstruction(
 	}
 
 	// Write the AddAttribute instruction parameters
-	binary.LittleEndian.PutUint16(su.encodingSpace[ndx:], uint16(len(attributeName)))
-	ndx += 2
-	copy(su.encodingSpace[ndx:], []byte(attributeName))
-	ndx += len(attributeName)
-	binary.LittleEndian.PutUint16(su.encodingSpace[ndx:], uint16(encodingType))
-	ndx += 2
-	binary.LittleEndian.PutUint32(su.encodingSpace[ndx:], uint32(len(indexValues)))
-	ndx += 4
-	for _, v := range indexValues {
-		binary.LittleEndian.PutUint64(su.encodingSpace[ndx:], uint64(v))
-		ndx += 8
-	}
+	ndx += encodeSymStreamAttributeInstruction(su.encodingSpace[ndx:], attributeName, encodingType, indexValues)
 
 	// Copy the data from the encodedSpace to the encodedCopy
 	encodedCopy := make([]byte, ndx)
@@ -176,16 +167,10 @@ func (su *M3DBSymStreamWriter) WriteAttributeInstruction(
 
 	go func(t xtime.UnixNano, encodedData []byte) {
 		su.pendingWrites.Add(1)
-		su.session.Write(
-			su.namespace,
-			su.streamId,
-			t,
-			0,
-			xtime.Millisecond,
-			encodedData)
+		err := su.backend.Append(su.namespace, su.streamId, t, encodedData)
 		su.pendingWrites.Add(-1)
 		if completionFn != nil {
-			completionFn(nil)
+			completionFn(err)
 		}
 	}(t, encodedCopy)
 
@@ -215,16 +200,50 @@ func (su *M3DBSymStreamWriter) WriteEndInstruction(
 
 	go func(t xtime.UnixNano, encodedData []byte) {
 		su.pendingWrites.Add(1)
-		su.session.Write(
-			su.namespace,
-			su.streamId,
-			t,
-			0,
-			xtime.Millisecond,
-			encodedData)
+		err := su.backend.Append(su.namespace, su.streamId, t, encodedData)
+		su.pendingWrites.Add(-1)
+		if completionFn != nil {
+			completionFn(err)
+		}
+	}(t, encodedCopy)
+
+	// TODO: Updates stats
+
+	return nil
+}
+
+func (su *M3DBSymStreamWriter) WriteDeleteInstruction(
+	version uint16,
+	sequenceNum uint32,
+	attributeName string,
+	index uint64,
+	completionFn WriteCompletionFn) error {
+	// Write the attribute table instruction param such that the decodeSymStreamDeleteParams
+	// function can parse it
+
+	// Write the header (version, flags, etc)
+	ndx := su.encodeHeader(su.encodingSpace, version, DeleteAttributeValue, sequenceNum)
+	if ndx <= 0 {
+		return errors.New("unable to write instruction header to the stream")
+	}
+
+	// Write the DeleteAttributeValue instruction parameters
+	ndx += encodeSymStreamDeleteInstruction(su.encodingSpace[ndx:], attributeName, index)
+
+	// Copy the data from the encodedSpace to the encodedCopy
+	encodedCopy := make([]byte, ndx)
+	copy(encodedCopy, su.encodingSpace[:ndx])
+
+	// Timestamp it here (instead of the goroutine) to capturne the intended
+	// chronological order of the instructions
+	t := xtime.Now()
+
+	go func(t xtime.UnixNano, encodedData []byte) {
+		su.pendingWrites.Add(1)
+		err := su.backend.Append(su.namespace, su.streamId, t, encodedData)
 		su.pendingWrites.Add(-1)
 		if completionFn != nil {
-			completionFn(nil)
+			completionFn(err)
 		}
 	}(t, encodedCopy)
 
@@ -257,19 +276,7 @@ func (su *M3DBSymStreamWriter) Wait(timeout time.Duration) error {
 func (su *M3DBSymStreamWriter) encodeAttributeValues(
 	dst []byte,
 	attributeValues []string) int {
-
-	// Write the attribute values
-	sz := 0
-	binary.LittleEndian.PutUint32(dst[sz:], uint32(len(attributeValues)))
-	sz += 4
-	for _, v := range attributeValues {
-		binary.LittleEndian.PutUint16(dst[sz:], uint16(len(v)))
-		sz += 2
-		copy(dst[sz:], []byte(v))
-		sz += len(v)
-	}
-
-	return sz
+	return encodeSymStreamAttributeValues(dst, attributeValues)
 }
 
 // Write the header (version, flags, etc) to the stream
@@ -278,16 +285,5 @@ func (su *M3DBSymStreamWriter) encodeHeader(
 	version uint16,
 	instruction TableInstruction,
 	sequenceNum uint32) int {
-
-	// Write the flags (version and instruction)
-	sz := 0
-	var flags uint32 = (uint32(instruction) & 0xFF) | (uint32(version) << 16)
-	binary.LittleEndian.PutUint32(dst[sz:], flags)
-	sz += 4
-
-	// Write the sequence number
-	binary.LittleEndian.PutUint32(dst[sz:], sequenceNum)
-	sz += 4
-
-	return sz
+	return encodeSymStreamHeader(dst, version, instruction, sequenceNum)
 }
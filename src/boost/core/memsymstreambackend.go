@@ -0,0 +1,99 @@
+package core
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/m3db/m3/src/x/ident"
+	xtime "github.com/m3db/m3/src/x/time"
+)
+
+// InMemorySymStreamBackend is a SymStreamBackend that keeps every appended
+// payload in memory, sorted by timestamp. It's meant for unit tests that
+// exercise SymStreamWriter/SymStreamReader without standing up a real m3db
+// session.
+type InMemorySymStreamBackend struct {
+	mu     sync.Mutex
+	series map[string][]memSymStreamRecord
+}
+
+type memSymStreamRecord struct {
+	ts      xtime.UnixNano
+	payload []byte
+}
+
+func NewInMemorySymStreamBackend() *InMemorySymStreamBackend {
+	return &InMemorySymStreamBackend{
+		series: make(map[string][]memSymStreamRecord),
+	}
+}
+
+func (b *InMemorySymStreamBackend) Append(
+	namespace ident.ID,
+	streamId ident.ID,
+	ts xtime.UnixNano,
+	payload []byte) error {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := memSeriesKey(namespace, streamId)
+	payloadCopy := make([]byte, len(payload))
+	copy(payloadCopy, payload)
+
+	records := b.series[key]
+	records = append(records, memSymStreamRecord{ts: ts, payload: payloadCopy})
+	sort.Slice(records, func(i, j int) bool { return records[i].ts < records[j].ts })
+	b.series[key] = records
+
+	return nil
+}
+
+func (b *InMemorySymStreamBackend) Scan(
+	namespace ident.ID,
+	streamId ident.ID,
+	start xtime.UnixNano,
+	end xtime.UnixNano) (SymStreamBackendIterator, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := memSeriesKey(namespace, streamId)
+	matched := make([]memSymStreamRecord, 0)
+	for _, rec := range b.series[key] {
+		if rec.ts < start {
+			continue
+		}
+		if end > 0 && rec.ts >= end {
+			continue
+		}
+		matched = append(matched, rec)
+	}
+
+	return &memSymStreamBackendIterator{records: matched, pos: -1}, nil
+}
+
+func (b *InMemorySymStreamBackend) Close() error {
+	return nil
+}
+
+func memSeriesKey(namespace ident.ID, streamId ident.ID) string {
+	return namespace.String() + "::" + streamId.String()
+}
+
+type memSymStreamBackendIterator struct {
+	records []memSymStreamRecord
+	pos     int
+}
+
+func (it *memSymStreamBackendIterator) Next() bool {
+	it.pos++
+	return it.pos < len(it.records)
+}
+
+func (it *memSymStreamBackendIterator) Current() []byte {
+	return it.records[it.pos].payload
+}
+
+func (it *memSymStreamBackendIterator) Close() {
+}
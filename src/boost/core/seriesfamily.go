@@ -1,6 +1,7 @@
 package core
 
 import (
+	"github.com/m3db/m3/src/dbnode/ts"
 	"github.com/m3db/m3/src/x/ident"
 	xtime "github.com/m3db/m3/src/x/time"
 )
@@ -35,4 +36,128 @@ type SeriesFamily interface {
 		value float64,
 		unit xtime.Unit,
 		completionFn WriteCompletionFn) error
+
+	// Fetch returns a point lookup of id's values between startInclusive and
+	// endExclusive.
+	Fetch(
+		id ident.ID,
+		startInclusive xtime.UnixNano,
+		endExclusive xtime.UnixNano) (SeriesIterator, error)
+
+	// FetchByAttributes scans the family for every series whose attributes
+	// match attrs between startInclusive and endExclusive, resolving the
+	// predicate against each series' SymTable to an indexed-header mask
+	// (via SymTable.ResolvePredicateMask) so rows are tested against their
+	// raw indexed headers, rather than reconstructing every candidate
+	// series' attributes up front.
+	FetchByAttributes(
+		attrs ident.TagIterator,
+		startInclusive xtime.UnixNano,
+		endExclusive xtime.UnixNano,
+		opts FetchOptions) (SeriesFamilyIterator, error)
+}
+
+// SeriesIterator is the result of a SeriesFamily.Fetch point lookup. It
+// mirrors the usual dbnode series-iterator surface (ID/Namespace/Tags/Next/
+// Current/Err/Close) plus Attributes, which lazily decodes the current
+// datapoint's annotation against the series' SymTable.
+type SeriesIterator interface {
+	// ID returns the ID of the series.
+	ID() ident.ID
+
+	// Namespace returns the namespace of the series.
+	Namespace() ident.ID
+
+	// Tags returns the series' own M3DB-indexed tags.
+	Tags() ident.TagIterator
+
+	// Attributes returns the current datapoint's TAP attributes, decoded
+	// from its annotation against the series' SymTable.
+	Attributes() ident.TagIterator
+
+	// Next advances to the next datapoint. Returns false once exhausted.
+	Next() bool
+
+	// Current returns the current datapoint and its unit. The annotation
+	// result may be nil: BoostSeriesIterator always returns nil there and
+	// exposes the decoded annotation through Attributes instead.
+	Current() (ts.Datapoint, xtime.Unit, ts.Annotation)
+
+	// Err returns any error encountered, including a failure to decode or
+	// verify the current datapoint's annotation.
+	Err() error
+
+	// Close closes the iterator.
+	Close()
+}
+
+// AggregationFunc names a per-attribute-group aggregate FetchOptions can
+// request FetchByAttributes compute over the matched rows, in place of
+// materializing every row.
+type AggregationFunc int
+
+const (
+	// AggregationNone performs no aggregation; FetchByAttributes yields one
+	// row per matched datapoint (the default).
+	AggregationNone AggregationFunc = iota
+
+	// AggregationSum sums the matched rows' values per group.
+	AggregationSum
+
+	// AggregationCount counts the matched rows per group.
+	AggregationCount
+
+	// AggregationMin tracks the smallest matched value per group.
+	AggregationMin
+
+	// AggregationMax tracks the largest matched value per group.
+	AggregationMax
+
+	// AggregationAvg averages the matched rows' values per group.
+	AggregationAvg
+)
+
+// FetchOptions controls how FetchByAttributes materializes and aggregates
+// the rows it matches.
+type FetchOptions struct {
+	// Projection restricts which attribute columns the iterator
+	// materializes per row; a nil or empty Projection materializes every
+	// attribute column the series has.
+	Projection []string
+
+	// Aggregations requests an aggregate (see AggregationFunc) per
+	// attribute name, computed incrementally over the matched rows'
+	// already-resolved values rather than by re-scanning. An attribute
+	// name's group is every matched row that carries that attribute; rows
+	// are not split by the attribute's value, so each name yields a single
+	// result. Callers that set this should read the result via
+	// the iterator's Aggregates method once it's exhausted, rather than its
+	// per-row Current.
+	Aggregations map[string]AggregationFunc
+
+	// Limit caps the number of rows FetchByAttributes yields; 0 means
+	// unlimited.
+	Limit int
+}
+
+// SeriesFamilyIterator walks the rows matched by SeriesFamily.FetchByAttributes,
+// one (id, attributes, timestamp, value) tuple at a time. Rows that fail the
+// predicate are tested against their raw indexed header and never have their
+// attributes reconstructed; a matched row's attributes are reconstructed via
+// SymTable.GetAttributesFromIndexedHeader when Next reaches it, whether or
+// not Current is then called.
+type SeriesFamilyIterator interface {
+	// Next advances to the next matched row. Returns false once exhausted.
+	Next() bool
+
+	// Current returns the current row: the series id, its attribute map
+	// (trimmed to FetchOptions.Projection if one was given), the
+	// datapoint's timestamp and its value.
+	Current() (id ident.ID, attributes map[string]string, t xtime.UnixNano, value float64)
+
+	// Err returns any error encountered while scanning or decoding.
+	Err() error
+
+	// Close closes the iterator and releases the underlying scan.
+	Close()
 }
@@ -0,0 +1,38 @@
+package core
+
+import (
+	"github.com/m3db/m3/src/x/ident"
+	xtime "github.com/m3db/m3/src/x/time"
+)
+
+// SymStreamBackend decouples SymStreamWriter/SymStreamReader from any one
+// storage system. Append persists a single instruction payload for
+// (namespace, streamId) at ts; Scan returns every payload written for
+// (namespace, streamId) in [start, end) in timestamp order.
+type SymStreamBackend interface {
+
+	// Append persists payload for (namespace, streamId) at ts.
+	Append(namespace ident.ID, streamId ident.ID, ts xtime.UnixNano, payload []byte) error
+
+	// Scan returns an iterator over every payload written for
+	// (namespace, streamId) with a timestamp in [start, end).
+	Scan(namespace ident.ID, streamId ident.ID, start xtime.UnixNano, end xtime.UnixNano) (SymStreamBackendIterator, error)
+
+	// Close releases any resources held by the backend.
+	Close() error
+}
+
+// SymStreamBackendIterator iterates the payloads a Scan matched, in
+// timestamp order.
+type SymStreamBackendIterator interface {
+
+	// Next advances the iterator. Returns false once exhausted.
+	Next() bool
+
+	// Current returns the payload at the iterator's current position.
+	// Only valid after a call to Next() that returned true.
+	Current() []byte
+
+	// Close releases any resources held by the iterator.
+	Close()
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// symstreamcodec.go holds the on-wire encode/decode routines shared by every
+// SymStreamWriter/SymStreamReader pair (M3DB-backed, Kafka-backed, ...) so
+// the instruction framing only has to be gotten right in one place.
+
+// encodeSymStreamHeader writes the 8 byte header (version, instruction,
+// sequence number) used to prefix every instruction record.
+func encodeSymStreamHeader(
+	dst []byte,
+	version uint16,
+	instruction TableInstruction,
+	sequenceNum uint32) int {
+
+	sz := 0
+	var flags uint32 = (uint32(instruction) & 0xFF) | (uint32(version) << 16)
+	binary.LittleEndian.PutUint32(dst[sz:], flags)
+	sz += 4
+
+	binary.LittleEndian.PutUint32(dst[sz:], sequenceNum)
+	sz += 4
+
+	return sz
+}
+
+// decodeSymStreamHeader is the inverse of encodeSymStreamHeader.
+func decodeSymStreamHeader(raw []byte) (uint16, TableInstruction, uint32, error) {
+	if len(raw) < 8 {
+		return 0, 0, 0, errors.New("invalid symbol table header")
+	}
+
+	flags := binary.LittleEndian.Uint32(raw)
+	version := uint16(flags >> 16) // Upper 16 bits
+	instruction := flags & 0xFF    // Lower 8 bits
+	sequenceNum := binary.LittleEndian.Uint32(raw[4:])
+
+	if instruction >= uint32(NOPInstruction) {
+		return 0, 0, 0, errors.New("invalid instruction")
+	}
+
+	return version, TableInstruction(instruction), sequenceNum, nil
+}
+
+// encodeSymStreamAttributeValues writes the dictionary instruction body
+// (InitSymTable/UpdateSymTable) used by the writer side.
+func encodeSymStreamAttributeValues(dst []byte, attributeValues []string) int {
+	sz := 0
+	binary.LittleEndian.PutUint32(dst[sz:], uint32(len(attributeValues)))
+	sz += 4
+	for _, v := range attributeValues {
+		binary.LittleEndian.PutUint16(dst[sz:], uint16(len(v)))
+		sz += 2
+		copy(dst[sz:], []byte(v))
+		sz += len(v)
+	}
+	return sz
+}
+
+// decodeSymStreamDictionaryParams is the inverse of
+// encodeSymStreamAttributeValues.
+func decodeSymStreamDictionaryParams(raw []byte) ([]string, error) {
+	if len(raw) < 4 {
+		return nil, errors.New("invalid symbol table data")
+	}
+	numValues := binary.LittleEndian.Uint32(raw)
+	raw = raw[4:]
+	values := make([]string, numValues)
+	for i := 0; i < int(numValues); i++ {
+		valueLen := binary.LittleEndian.Uint16(raw)
+		raw = raw[2:]
+		values[i] = string(raw[:valueLen])
+		raw = raw[valueLen:]
+	}
+
+	return values, nil
+}
+
+// encodeSymStreamAttributeInstruction writes the AddAttribute instruction
+// body used by the writer side. AttributeEncodingRoaringBitmap index values
+// are packed as Roaring containers (see roaringattribute.go); every other
+// encoding keeps the flat 8-byte-per-value array layout.
+func encodeSymStreamAttributeInstruction(
+	dst []byte,
+	attributeName string,
+	encodingType AttributeEncoding,
+	indexValues []uint64) int {
+
+	ndx := 0
+	binary.LittleEndian.PutUint16(dst[ndx:], uint16(len(attributeName)))
+	ndx += 2
+	copy(dst[ndx:], []byte(attributeName))
+	ndx += len(attributeName)
+	binary.LittleEndian.PutUint16(dst[ndx:], uint16(encodingType))
+	ndx += 2
+
+	if encodingType == AttributeEncodingRoaringBitmap {
+		ndx += encodeRoaringIndexValues(dst[ndx:], indexValues)
+		return ndx
+	}
+
+	binary.LittleEndian.PutUint32(dst[ndx:], uint32(len(indexValues)))
+	ndx += 4
+	for _, v := range indexValues {
+		binary.LittleEndian.PutUint64(dst[ndx:], v)
+		ndx += 8
+	}
+	return ndx
+}
+
+// decodeSymStreamAddAttributeParams is the inverse of
+// encodeSymStreamAttributeInstruction. It dispatches on the encoding type
+// byte already present in the body so callers always get back the same
+// []uint64, regardless of how it was packed on the wire.
+func decodeSymStreamAddAttributeParams(raw []byte) (string, AttributeEncoding, []uint64, error) {
+	if len(raw) < 2 {
+		return "", 0, nil, errors.New("invalid symbol table data")
+	}
+	attrNameLen := binary.LittleEndian.Uint16(raw)
+	raw = raw[2:]
+	attrName := string(raw[:attrNameLen])
+	raw = raw[attrNameLen:]
+	encodingType := AttributeEncoding(binary.LittleEndian.Uint16(raw))
+	raw = raw[2:]
+
+	if encodingType == AttributeEncodingRoaringBitmap {
+		values, err := decodeRoaringIndexValues(raw)
+		if err != nil {
+			return "", 0, nil, err
+		}
+		return attrName, encodingType, values, nil
+	}
+
+	numValues := binary.LittleEndian.Uint32(raw)
+	raw = raw[4:]
+	values := make([]uint64, numValues)
+	for i := 0; i < int(numValues); i++ {
+		values[i] = binary.LittleEndian.Uint64(raw)
+		raw = raw[8:]
+	}
+
+	return attrName, encodingType, values, nil
+}
+
+// encodeSymStreamDeleteInstruction writes the DeleteAttributeValue
+// instruction body used by the writer side: the attribute name and the
+// dictionary index being tombstoned.
+func encodeSymStreamDeleteInstruction(dst []byte, attributeName string, index uint64) int {
+	ndx := 0
+	binary.LittleEndian.PutUint16(dst[ndx:], uint16(len(attributeName)))
+	ndx += 2
+	copy(dst[ndx:], []byte(attributeName))
+	ndx += len(attributeName)
+	binary.LittleEndian.PutUint64(dst[ndx:], index)
+	ndx += 8
+	return ndx
+}
+
+// decodeSymStreamDeleteParams is the inverse of
+// encodeSymStreamDeleteInstruction.
+func decodeSymStreamDeleteParams(raw []byte) (string, uint64, error) {
+	if len(raw) < 2 {
+		return "", 0, errors.New("invalid symbol table data")
+	}
+	attrNameLen := binary.LittleEndian.Uint16(raw)
+	raw = raw[2:]
+	if len(raw) < int(attrNameLen)+8 {
+		return "", 0, errors.New("invalid symbol table data")
+	}
+	attrName := string(raw[:attrNameLen])
+	raw = raw[attrNameLen:]
+	index := binary.LittleEndian.Uint64(raw)
+
+	return attrName, index, nil
+}
@@ -16,6 +16,9 @@ const (
 	// End Dictionary
 	EndSymTable
 
+	// Tombstone a previously written attribute value
+	DeleteAttributeValue
+
 	// NOP
 	NOPInstruction
 )
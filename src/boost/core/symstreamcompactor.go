@@ -0,0 +1,234 @@
+package core
+
+import (
+	"errors"
+	"time"
+)
+
+// SymStreamSnapshotPointer is the small piece of metadata a reader consults
+// to bound recovery time after compaction: instructions with sequence
+// number <= ThroughSeqNum live in SnapshotStreamId/SnapshotVersion; anything
+// after that must still be read by tailing the original stream from
+// ThroughSeqNum+1.
+type SymStreamSnapshotPointer struct {
+	SnapshotStreamId string
+	SnapshotVersion  uint16
+	ThroughSeqNum    uint32
+}
+
+// SymStreamCompactorConfig configures how often a SymStreamCompactor should
+// run and how much instruction history it tolerates accumulating between
+// runs.
+type SymStreamCompactorConfig struct {
+
+	// CompactionInterval is the wall clock time since the last snapshot
+	// after which ShouldCompact reports true, whatever the instruction
+	// volume. Zero disables this trigger. The compactor
+	// doesn't own a ticker; callers that want a background cadence should
+	// poll ShouldCompact on their own schedule.
+	CompactionInterval time.Duration
+
+	// MaxInstructionsSinceSnapshot is the number of instructions tolerated
+	// since the last snapshot before ShouldCompact reports true regardless
+	// of CompactionInterval. Zero disables this trigger.
+	MaxInstructionsSinceSnapshot uint32
+}
+
+// SourceCutover is invoked once a snapshot's EndSymTable write has been
+// acked via Wait(), so the caller can reclaim the now-redundant prefix of
+// the source stream (e.g. advance a TTL boundary, or physically delete
+// points up to throughSeqNum). It's optional cleanup: the snapshot pointer
+// returned by Compact is already sufficient for bounded-time recovery.
+type SourceCutover func(throughSeqNum uint32) error
+
+// mergedAttribute is the latest-write-wins state tracked per attribute name
+// while folding a stream's AddAttribute instructions.
+type mergedAttribute struct {
+	encoding    AttributeEncoding
+	indexValues []uint64
+}
+
+// SymStreamCompactor periodically folds an entire Init/Update/AddAttribute
+// instruction stream into a single equivalent InitSymTable + AddAttribute
+// set (an LSM-style compaction), so recovering a long-lived symbol stream
+// is bounded by snapshot size rather than by its full history.
+type SymStreamCompactor struct {
+	config SymStreamCompactorConfig
+
+	lastSnapshotAt            time.Time
+	instructionsSinceSnapshot uint32
+}
+
+func NewSymStreamCompactor(config SymStreamCompactorConfig) *SymStreamCompactor {
+	return &SymStreamCompactor{config: config}
+}
+
+// Observe lets a caller that's tailing the live stream (e.g. the writer
+// side) feed the compactor the number of instructions it has just written,
+// so ShouldCompact can trigger on MaxInstructionsSinceSnapshot without the
+// compactor itself having to tail the stream.
+func (c *SymStreamCompactor) Observe(numInstructions uint32) {
+	c.instructionsSinceSnapshot += numInstructions
+}
+
+// ShouldCompact reports whether Compact should run now, given how long it's
+// been since the last snapshot and how many instructions have accumulated
+// since then.
+func (c *SymStreamCompactor) ShouldCompact(now time.Time) bool {
+	if c.lastSnapshotAt.IsZero() {
+		return true
+	}
+	if c.config.MaxInstructionsSinceSnapshot > 0 &&
+		c.instructionsSinceSnapshot >= c.config.MaxInstructionsSinceSnapshot {
+		return true
+	}
+	if c.config.CompactionInterval > 0 &&
+		now.Sub(c.lastSnapshotAt) >= c.config.CompactionInterval {
+		return true
+	}
+	return false
+}
+
+// Compact reads the entire stream from reader, folds every Init/Update/
+// AddAttribute instruction into a single merged InitSymTable + AddAttribute
+// set, and writes that as a new snapshot (snapshotStreamId, snapshotVersion)
+// via writer. The merge is deterministic: attribute name ordering follows
+// first-seen order in the source stream, and the last AddAttribute
+// instruction observed for a given name wins (its encoding and index
+// values). Any DeleteAttributeValue instruction seen for an attribute is
+// tracked by index and strips the matching entry out of that attribute's
+// merged index values before the snapshot is written, so a tombstoned
+// value doesn't get resurrected by compaction. The snapshot pointer is
+// only returned - and cutover only invoked - once the snapshot's
+// EndSymTable write has been acked via writer.Wait(), so a reader can
+// never observe a pointer to a half-written snapshot.
+func (c *SymStreamCompactor) Compact(
+	reader SymStreamReader,
+	writer SymStreamWriter,
+	snapshotStreamId string,
+	snapshotVersion uint16,
+	cutover SourceCutover) (SymStreamSnapshotPointer, error) {
+
+	if err := reader.Seek(0, 0); err != nil {
+		return SymStreamSnapshotPointer{}, err
+	}
+
+	var dictValues []string
+	attributeOrder := make([]string, 0)
+	attributes := make(map[string]mergedAttribute)
+	tombstoned := make(map[string]map[uint64]bool)
+	var throughSeqNum uint32
+	seenInit := false
+
+	for {
+		_, seqNum, instruction, err := reader.Next()
+		if err != nil {
+			return SymStreamSnapshotPointer{}, err
+		}
+		if instruction == NOPInstruction {
+			break
+		}
+
+		switch instruction {
+		case InitSymTable:
+			values, err := reader.ReadInitInstruction()
+			if err != nil {
+				return SymStreamSnapshotPointer{}, err
+			}
+			dictValues = append(dictValues, values...)
+			seenInit = true
+
+		case UpdateSymTable:
+			values, err := reader.ReadUpdateInstruction()
+			if err != nil {
+				return SymStreamSnapshotPointer{}, err
+			}
+			dictValues = append(dictValues, values...)
+
+		case AddAttribute:
+			name, encodingType, indexValues, err := reader.ReadAttributeInstruction()
+			if err != nil {
+				return SymStreamSnapshotPointer{}, err
+			}
+			if _, ok := attributes[name]; !ok {
+				attributeOrder = append(attributeOrder, name)
+			}
+			attributes[name] = mergedAttribute{encoding: encodingType, indexValues: indexValues}
+
+		case DeleteAttributeValue:
+			name, index, err := reader.ReadDeleteInstruction()
+			if err != nil {
+				return SymStreamSnapshotPointer{}, err
+			}
+			if tombstoned[name] == nil {
+				tombstoned[name] = make(map[uint64]bool)
+			}
+			tombstoned[name][index] = true
+		}
+
+		throughSeqNum = seqNum
+	}
+
+	if !seenInit {
+		return SymStreamSnapshotPointer{}, errors.New("unable to compact a stream with no InitSymTable instruction")
+	}
+
+	var writeErr error
+	completion := func(err error) {
+		if err != nil {
+			writeErr = err
+		}
+	}
+
+	if err := writer.WriteInitInstruction(snapshotVersion, dictValues, completion); err != nil {
+		return SymStreamSnapshotPointer{}, err
+	}
+
+	seqNum := uint32(1)
+	for _, name := range attributeOrder {
+		attr := attributes[name]
+		if deleted := tombstoned[name]; len(deleted) > 0 {
+			indexValues := make([]uint64, 0, len(attr.indexValues))
+			for _, index := range attr.indexValues {
+				if !deleted[index] {
+					indexValues = append(indexValues, index)
+				}
+			}
+			attr.indexValues = indexValues
+		}
+		seqNum++
+		if err := writer.WriteAttributeInstruction(
+			snapshotVersion, seqNum, name, attr.encoding, attr.indexValues, completion); err != nil {
+			return SymStreamSnapshotPointer{}, err
+		}
+	}
+
+	seqNum++
+	if err := writer.WriteEndInstruction(snapshotVersion, seqNum, completion); err != nil {
+		return SymStreamSnapshotPointer{}, err
+	}
+
+	if err := writer.Wait(0); err != nil {
+		return SymStreamSnapshotPointer{}, err
+	}
+	if writeErr != nil {
+		return SymStreamSnapshotPointer{}, writeErr
+	}
+
+	// Only now, with the snapshot's EndSymTable write acked, is it safe to
+	// let the caller reclaim the compacted prefix of the source stream.
+	if cutover != nil {
+		if err := cutover(throughSeqNum); err != nil {
+			return SymStreamSnapshotPointer{}, err
+		}
+	}
+
+	c.lastSnapshotAt = time.Now()
+	c.instructionsSinceSnapshot = 0
+
+	return SymStreamSnapshotPointer{
+		SnapshotStreamId: snapshotStreamId,
+		SnapshotVersion:  snapshotVersion,
+		ThroughSeqNum:    throughSeqNum,
+	}, nil
+}
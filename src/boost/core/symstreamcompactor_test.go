@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	xtime "github.com/m3db/m3/src/x/time"
+)
+
+// fakeCompactorInstruction is a single scripted step a fakeCompactorReader
+// replays from Next/Read*Instruction, letting a test build an arbitrary
+// instruction stream for Compact to fold without a real backing store.
+type fakeCompactorInstruction struct {
+	seqNum      uint32
+	instruction TableInstruction
+
+	// dictValues backs ReadInitInstruction/ReadUpdateInstruction.
+	dictValues []string
+
+	// attrName, encoding and indexValues back ReadAttributeInstruction.
+	attrName    string
+	encoding    AttributeEncoding
+	indexValues []uint64
+
+	// deletedIndex backs ReadDeleteInstruction, alongside attrName.
+	deletedIndex uint64
+}
+
+// fakeCompactorReader is a SymStreamReader driven entirely by a pre-scripted
+// slice of instructions, so Compact can be exercised without a real stream.
+type fakeCompactorReader struct {
+	instructions []fakeCompactorInstruction
+	pos          int
+	current      fakeCompactorInstruction
+}
+
+func (r *fakeCompactorReader) Seek(startTime, endTime xtime.UnixNano) error {
+	r.pos = 0
+	return nil
+}
+
+func (r *fakeCompactorReader) Next() (uint16, uint32, TableInstruction, error) {
+	if r.pos >= len(r.instructions) {
+		return 0, 0, NOPInstruction, nil
+	}
+	r.current = r.instructions[r.pos]
+	r.pos++
+	return 1, r.current.seqNum, r.current.instruction, nil
+}
+
+func (r *fakeCompactorReader) ReadInitInstruction() ([]string, error) {
+	return r.current.dictValues, nil
+}
+
+func (r *fakeCompactorReader) ReadUpdateInstruction() ([]string, error) {
+	return r.current.dictValues, nil
+}
+
+func (r *fakeCompactorReader) ReadAttributeInstruction() (string, AttributeEncoding, []uint64, error) {
+	return r.current.attrName, r.current.encoding, r.current.indexValues, nil
+}
+
+func (r *fakeCompactorReader) ReadEndInstruction() (string, []uint64, error) {
+	return "", nil, nil
+}
+
+func (r *fakeCompactorReader) ReadDeleteInstruction() (string, uint64, error) {
+	return r.current.attrName, r.current.deletedIndex, nil
+}
+
+func (r *fakeCompactorReader) Follow(ctx context.Context, startTime xtime.UnixNano) (<-chan Instruction, error) {
+	return nil, errors.New("Follow not supported by fakeCompactorReader")
+}
+
+// fakeCompactorWriter is a SymStreamWriter that records every instruction
+// written to it, so a test can assert on the merged snapshot Compact
+// produced without a real backing store.
+type fakeCompactorWriter struct {
+	initValues []string
+	attrWrites []mergedAttribute
+	attrNames  []string
+}
+
+func (w *fakeCompactorWriter) WriteInitInstruction(
+	version uint16, attributeValues []string, completionFn WriteCompletionFn) error {
+	w.initValues = attributeValues
+	return nil
+}
+
+func (w *fakeCompactorWriter) WriteUpdateInstruction(
+	version uint16, sequenceNum uint32, attributeValues []string, completionFn WriteCompletionFn) error {
+	return nil
+}
+
+func (w *fakeCompactorWriter) WriteAttributeInstruction(
+	version uint16,
+	sequenceNum uint32,
+	attributeName string,
+	encodingType AttributeEncoding,
+	indexValues []uint64,
+	completionFn WriteCompletionFn) error {
+	w.attrNames = append(w.attrNames, attributeName)
+	w.attrWrites = append(w.attrWrites, mergedAttribute{encoding: encodingType, indexValues: indexValues})
+	return nil
+}
+
+func (w *fakeCompactorWriter) WriteEndInstruction(
+	version uint16, sequenceNum uint32, completionFc WriteCompletionFn) error {
+	return nil
+}
+
+func (w *fakeCompactorWriter) WriteDeleteInstruction(
+	version uint16, sequenceNum uint32, attributeName string, index uint64, completionFn WriteCompletionFn) error {
+	return nil
+}
+
+func (w *fakeCompactorWriter) Wait(timeout time.Duration) error {
+	return nil
+}
+
+func TestSymStreamCompactorStripsTombstonedIndices(t *testing.T) {
+	reader := &fakeCompactorReader{instructions: []fakeCompactorInstruction{
+		{seqNum: 1, instruction: InitSymTable, dictValues: []string{"a", "b", "c"}},
+		{seqNum: 2, instruction: AddAttribute, attrName: "host", encoding: DictionaryEncodedValue, indexValues: []uint64{0, 1, 2}},
+		{seqNum: 3, instruction: DeleteAttributeValue, attrName: "host", deletedIndex: 1},
+		{seqNum: 4, instruction: EndSymTable},
+	}}
+	writer := &fakeCompactorWriter{}
+
+	compactor := NewSymStreamCompactor(SymStreamCompactorConfig{})
+	pointer, err := compactor.Compact(reader, writer, "snap", 1, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint32(4), pointer.ThroughSeqNum)
+
+	require.Equal(t, []string{"host"}, writer.attrNames)
+	require.Equal(t, []uint64{0, 2}, writer.attrWrites[0].indexValues)
+}
@@ -1,9 +1,47 @@
 package core
 
 import (
+	"context"
+	"errors"
+
 	xtime "github.com/m3db/m3/src/x/time"
 )
 
+// ErrSequenceGap is sent on a Follow channel (via Instruction.Err) when a
+// poll observes a sequence number that isn't one greater than the last
+// instruction seen for the current version. It signals that the tail the
+// caller has buffered can no longer be trusted and a fresh read starting
+// from the last InitSymTable is required.
+var ErrSequenceGap = errors.New("gap detected in symbol table instruction sequence")
+
+// Instruction is the decoded, self-contained representation of a single
+// symbol table instruction emitted by SymStreamReader.Follow. It carries
+// whichever params are meaningful for Kind so a subscriber doesn't need to
+// re-poke the reader's Read*Instruction methods to make use of it. Err is
+// set (and every other field left at its zero value) when Follow can no
+// longer continue, e.g. with ErrSequenceGap.
+type Instruction struct {
+	Version uint16
+	SeqNum  uint32
+	Kind    TableInstruction
+
+	// AttributeValues carries the decoded params for InitSymTable and
+	// UpdateSymTable.
+	AttributeValues []string
+
+	// AttributeName, Encoding and IndexValues carry the decoded params for
+	// AddAttribute.
+	AttributeName string
+	Encoding      AttributeEncoding
+	IndexValues   []uint64
+
+	// DeletedIndex carries the tombstoned dictionary index for
+	// DeleteAttributeValue, alongside AttributeName.
+	DeletedIndex uint64
+
+	Err error
+}
+
 // A Symbol Table Stream Reader provides the interface to read the symbol
 // table operations encoded in the stream.
 type SymStreamReader interface {
@@ -35,4 +73,18 @@ type SymStreamReader interface {
 	// location of the underlying stream. Return error if the instruction
 	// could not be read.
 	ReadEndInstruction() (string, []uint64, error)
+
+	// Read DeleteAttributeValue instruction parameters from the current
+	// position in the stream: the attribute name and the tombstoned
+	// dictionary index. If the current instruction is not
+	// DeleteAttributeValue, return error.
+	ReadDeleteInstruction() (string, uint64, error)
+
+	// Follow seeks to startTime, drains the historical instructions, then
+	// continues polling the underlying stream for newly arrived
+	// instructions and emits them on the returned channel until ctx is
+	// cancelled, at which point the channel is closed. A gap in the
+	// instruction sequence is surfaced as an Instruction with Err set to
+	// ErrSequenceGap, after which the channel is closed.
+	Follow(ctx context.Context, startTime xtime.UnixNano) (<-chan Instruction, error)
 }
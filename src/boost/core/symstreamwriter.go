@@ -42,6 +42,16 @@ type SymStreamWriter interface {
 		sequenceNum uint32,
 		completionFc WriteCompletionFn) error
 
+	// Write the DeleteAttributeValue instruction with the specified version,
+	// sequence number, attribute name and the dictionary-encoded index being
+	// tombstoned.
+	WriteDeleteInstruction(
+		version uint16,
+		sequenceNum uint32,
+		atributeName string,
+		index uint64,
+		completionFn WriteCompletionFn) error
+
 	// Wait for all pending write operations to complete or until the specified
 	// timeout is reached. If timeout is 0, wait indefinitely wait for all
 	// pending writes to complete.
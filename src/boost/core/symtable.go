@@ -2,9 +2,46 @@ package core
 
 import (
 	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 )
 
+// c_TombstoneSentinel marks a dictionary-encoded attribute value as deleted
+// (see DeleteAttributeValue): the attribute's encodedValues slot is set to
+// this rather than removed outright, so every other value's position (and
+// therefore its externally visible index) is left undisturbed. No real
+// dictionary index ever reaches this value, since dictToString is keyed by
+// insertion order starting at 0.
+const c_TombstoneSentinel uint64 = math.MaxUint64
+
+// c_FNVOffsetBasis64/c_FNVPrime64 are the standard FNV-1a 64-bit constants,
+// used to fold inserted values into SymTable.contentHash incrementally so
+// peers can detect divergence without comparing the whole table.
+const (
+	c_FNVOffsetBasis64 uint64 = 14695981039346656037
+	c_FNVPrime64       uint64 = 1099511628211
+)
+
+func foldHashString(h uint64, s string) uint64 {
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= c_FNVPrime64
+	}
+	return h
+}
+
+func foldHashUint64(h uint64, v uint64) uint64 {
+	for i := 0; i < 8; i++ {
+		h ^= v & 0xFF
+		h *= c_FNVPrime64
+		v >>= 8
+	}
+	return h
+}
+
 // Supported attribute encodings
 type AttributeEncoding int
 
@@ -14,19 +51,54 @@ const (
 
 	// Dictionary encoding. AttributeTable will index into to a dictionary.
 	DictionaryEncodedValue
+
+	// Values are encoded as a Roaring bitmap: array/bitmap/run containers
+	// keyed by the upper 16 bits of each value. See roaringattribute.go.
+	AttributeEncodingRoaringBitmap
 )
 
 // All symbols part of an attribute are indexed seperately.
 type AttributeTable struct {
-	name                   string
-	encodingType           AttributeEncoding
+	name         string
+	encodingType AttributeEncoding
+
+	// encodedValues/encodedValuesFromIndex hold this attribute's inserted
+	// values when encodingType is DictionaryEncodedValue (or
+	// AttributeEncodingRoaringBitmap): encodedValues[i] is a dictToString
+	// index, so every lookup round-trips through the dictionary.
 	encodedValues          []uint64
 	encodedValuesFromIndex map[uint64]uint64
+
+	// numericValues/numericValuesFromIndex parallel encodedValues/
+	// encodedValuesFromIndex, but are only populated when encodingType is
+	// UnsignedNumericValue: numericValues[i] is the raw uint64 itself, so
+	// numeric-heavy attributes (timestamps, counters, IDs) never touch the
+	// string dictionary at all. See InsertNumericAttributeValues.
+	numericValues          []uint64
+	numericValuesFromIndex map[uint64]uint64
+
+	// valueOffset is non-zero only for an AttributeTable created inside a
+	// CacheWrap overlay for an attribute name that already existed on the
+	// parent: it's the parent's encoded-value count at wrap time, so the
+	// per-value indices this table hands out continue the parent's
+	// numbering instead of restarting at 0.
+	valueOffset uint64
 }
 
 // Symbol Table implementation
 type SymTable struct {
 
+	// mu guards every field below against concurrent access: the mutator
+	// methods (UpdateDictionary, InsertAttributeValue, InsertAttributeIndices,
+	// InsertNumericAttributeValue(s), Finalize, Discard) take it for writing;
+	// the accessors (FindAttributeIndex, AttributeValueExists,
+	// GetIndexedHeader, IsSame, NewIterator, ...) take it for reading.
+	// Internal helpers (lookupDictIndex, combinedDictSize, fillIndexedHeader
+	// and friends) assume the caller already holds sym's own lock, and only
+	// acquire a lock explicitly when stepping across to a parent table's
+	// fields, since a parent is a distinct SymTable with its own mu.
+	mu sync.RWMutex
+
 	// Name of the symbol table. Usually the seriesId with a prefix
 	// such as "m3_symboltable_"
 	name string
@@ -52,6 +124,125 @@ type SymTable struct {
 
 	// Stream writer
 	streamWriter SymStreamWriter
+
+	// opSeqNum is a monotonically increasing position within this table's
+	// own operation log, incremented once per committed mutation. Unlike
+	// instructionSeqNum (which only advances when a streamWriter is
+	// attached), this advances identically whether the table was built by
+	// live writes or reconstructed by replaying a stream, so Iterator/Apply
+	// work the same way on either. See Iterator.
+	opSeqNum uint32
+
+	// ops is the ordered log of committed mutations, used by Iterator to
+	// serve a peer everything since a given opSeqNum watermark.
+	ops []symTableOp
+
+	// contentHash is a rolling FNV-1a hash over every inserted dictionary
+	// value and attribute index, updated incrementally per insert so two
+	// tables can be compared cheaply via ContentHash() without walking
+	// either one in full.
+	contentHash uint64
+
+	// parent is non-nil only for a SymTable returned by CacheWrap: all the
+	// fields above belong to the overlay (the staged-but-not-yet-committed
+	// batch), and lookups that miss locally fall through to parent instead
+	// of failing. nil for an ordinary table.
+	parent *SymTable
+
+	// parentDictOffset/parentHeaderOffset are snapshotted from parent at
+	// CacheWrap time, so the overlay's own dictionary indices and header
+	// (column) indices continue parent's numbering instead of restarting
+	// at 0 - which matters because these indices get embedded verbatim in
+	// the wire annotation and must still be valid once Commit replays them
+	// onto parent.
+	parentDictOffset   uint64
+	parentHeaderOffset int
+}
+
+type symTableOpKind int
+
+const (
+	symTableOpDictionary symTableOpKind = iota
+	symTableOpAttribute
+	symTableOpNumericAttribute
+	symTableOpDelete
+)
+
+// symTableOp is a single recorded dictionary-update, attribute-insert or
+// attribute-delete operation, replayable via Apply onto another SymTable
+// along the same code path the original operation took.
+type symTableOp struct {
+	seqNum       uint32
+	kind         symTableOpKind
+	dictValues   []string
+	attrName     string
+	indices      []uint64
+	deletedIndex uint64
+}
+
+// SymTableOpIterator iterates the operations returned by SymTable.Iterator.
+// Call Next before the first Current-style accessor, mirroring the
+// Seek/Next/Read* convention used by SymStreamReader.
+type SymTableOpIterator struct {
+	ops []symTableOp
+	pos int
+}
+
+// Next advances to the next operation. Returns false once the iterator is
+// exhausted.
+func (it *SymTableOpIterator) Next() bool {
+	it.pos++
+	return it.pos < len(it.ops)
+}
+
+// SeqNum returns the current operation's position in the source table's
+// operation log.
+func (it *SymTableOpIterator) SeqNum() uint32 {
+	return it.ops[it.pos].seqNum
+}
+
+// IsAttribute returns true if the current operation is a dictionary-encoded
+// attribute insert (apply via InsertAttributeIndices) rather than a
+// dictionary update (apply via UpdateDictionary) or a numeric attribute
+// insert (see IsNumericAttribute).
+func (it *SymTableOpIterator) IsAttribute() bool {
+	return it.ops[it.pos].kind == symTableOpAttribute
+}
+
+// IsNumericAttribute returns true if the current operation is a numeric
+// attribute insert, apply via InsertNumericAttributeValues.
+func (it *SymTableOpIterator) IsNumericAttribute() bool {
+	return it.ops[it.pos].kind == symTableOpNumericAttribute
+}
+
+// IsDelete returns true if the current operation tombstones an attribute
+// value, apply via DeleteAttributeIndex.
+func (it *SymTableOpIterator) IsDelete() bool {
+	return it.ops[it.pos].kind == symTableOpDelete
+}
+
+// DeletedIndex returns the current operation's tombstoned dictionary
+// index. Only valid when IsDelete is true.
+func (it *SymTableOpIterator) DeletedIndex() uint64 {
+	return it.ops[it.pos].deletedIndex
+}
+
+// DictionaryValues returns the current operation's dictionary values. Only
+// valid when IsAttribute is false.
+func (it *SymTableOpIterator) DictionaryValues() []string {
+	return it.ops[it.pos].dictValues
+}
+
+// AttributeName returns the current operation's attribute name. Only valid
+// when IsAttribute is true.
+func (it *SymTableOpIterator) AttributeName() string {
+	return it.ops[it.pos].attrName
+}
+
+// AttributeIndices returns the current operation's attribute indices. Only
+// valid when IsAttribute is true.
+func (it *SymTableOpIterator) AttributeIndices() []uint64 {
+	return it.ops[it.pos].indices
 }
 
 //--------------
@@ -69,6 +260,8 @@ func NewSymTable(name string, version uint16, streamWriter SymStreamWriter) *Sym
 		header:            make(map[string]int),
 		attributeTable:    make(map[string]*AttributeTable),
 		streamWriter:      streamWriter,
+		opSeqNum:          0,
+		contentHash:       c_FNVOffsetBasis64,
 	}
 }
 
@@ -78,43 +271,98 @@ func NewSymTable(name string, version uint16, streamWriter SymStreamWriter) *Sym
 
 // Returns the name of the symbol table
 func (sym *SymTable) Name() string {
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
 	return sym.name
 }
 
 // Return the version of the symbol table
 func (sym *SymTable) Version() uint16 {
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
 	return sym.version
 }
 
 // Returns the number of symbols in the symbol table
 func (sym *SymTable) NumSymbols() int {
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
 	return len(sym.dictToString)
 }
 
 // Returns the number of attributes in the symbol table
 func (sym *SymTable) NumAttributes() int {
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
 	return len(sym.attributeTable)
 }
 
 // Returns true if the given attribute value already exists in the symbol table
 func (sym *SymTable) AttributeValueExists(value string) bool {
-	_, ok := sym.dictToIndex[value]
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
+	_, ok := sym.lookupDictIndex(value)
 	return ok
 }
 
 // Find the index of the given attribute value. If the attribute having the
-// specified name or the given value doesn't exist, return -1
+// specified name or the given value doesn't exist, return -1. On a
+// CacheWrap overlay, the overlay's own attribute table is consulted first,
+// falling through to the parent's if this attribute hasn't been touched
+// locally.
 func (sym *SymTable) FindAttributeIndex(name string, value string) int {
-	if _, ok := sym.attributeTable[name]; !ok {
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
+	return sym.findAttributeIndexLocked(name, value)
+}
+
+// findAttributeIndexLocked is FindAttributeIndex's body, pulled out so
+// callers that already hold sym.mu (fillIndexedHeader, most notably) can
+// reach it without re-locking the same mutex.
+func (sym *SymTable) findAttributeIndexLocked(name string, value string) int {
+	at, ok := sym.attributeTable[name]
+	if !ok {
+		if sym.parent != nil {
+			return sym.parent.FindAttributeIndex(name, value)
+		}
+		return -1
+	}
+
+	dictIndex, ok := sym.lookupDictIndex(value)
+	if !ok {
 		return -1
 	}
 
-	dictIndex, ok := sym.dictToIndex[value]
+	if val, ok := at.encodedValuesFromIndex[dictIndex]; ok {
+		return int(val)
+	}
+
+	return -1
+}
+
+// FindNumericAttributeIndex is the UnsignedNumericValue counterpart to
+// FindAttributeIndex: it looks value up directly in the attribute's
+// numericValuesFromIndex, bypassing the string dictionary entirely. If the
+// attribute having the specified name doesn't exist or the value hasn't
+// been inserted, return -1.
+func (sym *SymTable) FindNumericAttributeIndex(name string, value uint64) int {
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
+	return sym.findNumericAttributeIndexLocked(name, value)
+}
+
+// findNumericAttributeIndexLocked is FindNumericAttributeIndex's body; see
+// findAttributeIndexLocked for why it's split out.
+func (sym *SymTable) findNumericAttributeIndexLocked(name string, value uint64) int {
+	at, ok := sym.attributeTable[name]
 	if !ok {
+		if sym.parent != nil {
+			return sym.parent.FindNumericAttributeIndex(name, value)
+		}
 		return -1
 	}
 
-	if val, ok := sym.attributeTable[name].encodedValuesFromIndex[dictIndex]; ok {
+	if val, ok := at.numericValuesFromIndex[value]; ok {
 		return int(val)
 	}
 
@@ -123,98 +371,326 @@ func (sym *SymTable) FindAttributeIndex(name string, value string) int {
 
 // Return the index header for the given set of attributes. If input refers
 // to an attribute that does exist or a value that is not in the symbol table,
-// the corresponding index is set to -1 and will return false
+// the corresponding index is set to -1 and the returned bool is true. On a
+// CacheWrap overlay, the returned header spans both the parent's columns
+// and any new ones staged in the overlay.
 func (sym *SymTable) GetIndexedHeader(attributes map[string]string) ([]int, bool) {
-	header := make([]int, len(sym.header))
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
+
+	headerLen := sym.combinedHeaderLen()
+	header := make([]int, headerLen)
 
-	if len(sym.header) == 0 {
+	if headerLen == 0 {
 		return header, true
 	}
 
 	hasMissing := false
+	sym.fillIndexedHeader(sym, attributes, header, &hasMissing)
+
+	return header, hasMissing
+}
+
+// fillIndexedHeader fills header for sym's own columns, recursing into
+// parent first so parent's columns are filled before this table's (which
+// only ever holds entries for attribute names parent doesn't already
+// have - see InsertAttributeValue/InsertAttributeIndices). Values are
+// always resolved via root.findAttributeIndexLocked/
+// findNumericAttributeIndexLocked, not sym's, so that an attribute whose
+// column was defined on a distant ancestor still picks up values staged on
+// a nearer CacheWrap overlay. root is the table GetIndexedHeader was
+// originally called on, whose lock is held for the whole call, hence the
+// "Locked" (no self-lock) variants rather than FindAttributeIndex itself. A
+// numeric column's caller-supplied string is parsed back to a uint64 before
+// the lookup; a string that doesn't parse is treated the same as a value
+// the symbol table has never seen.
+//
+// Called with sym.mu already held by the caller; stepping into sym.parent's
+// own fields (which aren't covered by that lock) takes parent.mu explicitly.
+func (sym *SymTable) fillIndexedHeader(root *SymTable, attributes map[string]string, header []int, hasMissing *bool) {
+	if sym.parent != nil {
+		sym.parent.mu.RLock()
+		sym.parent.fillIndexedHeader(root, attributes, header, hasMissing)
+		sym.parent.mu.RUnlock()
+	}
+
 	for name, i := range sym.header {
 		header[i] = -1
 		val, ok := attributes[name]
-		if ok {
-			header[i] = sym.FindAttributeIndex(name, val)
-			if header[i] == -1 {
-				hasMissing = true
+		if !ok {
+			*hasMissing = true
+			continue
+		}
+
+		if encodingType, found := root.attributeEncodingType(name); found && encodingType == UnsignedNumericValue {
+			numericVal, err := strconv.ParseUint(val, 10, 64)
+			if err == nil {
+				header[i] = root.findNumericAttributeIndexLocked(name, numericVal)
 			}
 		} else {
-			hasMissing = true
+			header[i] = root.findAttributeIndexLocked(name, val)
+		}
+
+		if header[i] == -1 {
+			*hasMissing = true
 		}
 	}
+}
 
-	return header, hasMissing
+// attributeEncodingType returns the encoding type name's AttributeTable was
+// created with, checking sym's own attributeTable first and falling through
+// to parent (if any). Called with sym.mu already held by the caller; see
+// fillIndexedHeader.
+func (sym *SymTable) attributeEncodingType(name string) (AttributeEncoding, bool) {
+	if at, ok := sym.attributeTable[name]; ok {
+		return at.encodingType, true
+	}
+	if sym.parent != nil {
+		sym.parent.mu.RLock()
+		defer sym.parent.mu.RUnlock()
+		return sym.parent.attributeEncodingType(name)
+	}
+	return 0, false
 }
 
-// Return the attribute name and value map for the given indexed header
+// Return the attribute name and value map for the given indexed header. A
+// numeric column's value is formatted back to its decimal string form
+// rather than resolved through the dictionary - see FindNumericAttributeValue.
 func (sym *SymTable) GetAttributesFromIndexedHeader(header []int) map[string]string {
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
+
 	attributes := make(map[string]string)
 	for name, i := range sym.header {
 		if i < len(header) {
 			if header[i] != -1 {
-				attributes[name] = sym.FindAttributeValue(name, uint64(header[i]))
+				if encodingType, ok := sym.attributeEncodingType(name); ok && encodingType == UnsignedNumericValue {
+					if numericVal, ok := sym.findNumericAttributeValueLocked(name, uint64(header[i])); ok {
+						attributes[name] = strconv.FormatUint(numericVal, 10)
+					}
+				} else if !sym.attributeIndexTombstonedLocked(name, uint64(header[i])) {
+					attributes[name] = sym.findAttributeValueLocked(name, uint64(header[i]))
+				}
 			}
 		}
 	}
 	return attributes
 }
 
+// ResolvePredicateMask resolves every (name, value) pair in predicate to
+// the header position it occupies and the index a matching row's
+// IndexedHeader must hold at that position, so a caller (e.g.
+// M3DBSeriesFamilyIterator.Next) can test a row against predicate with a
+// handful of integer comparisons instead of resolving the full header to a
+// string attribute map first. ok is false if any predicate value isn't
+// known to this table at all - a missing column or a value this table has
+// never recorded - in which case no row built from this table can satisfy
+// predicate and the caller can skip straight to the next series.
+func (sym *SymTable) ResolvePredicateMask(predicate map[string]string) (mask map[int]uint64, ok bool) {
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
+
+	mask = make(map[int]uint64, len(predicate))
+	for name, value := range predicate {
+		pos, found := sym.headerPositionLocked(name)
+		if !found {
+			return nil, false
+		}
+
+		var index int
+		if encodingType, found := sym.attributeEncodingType(name); found && encodingType == UnsignedNumericValue {
+			numericVal, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, false
+			}
+			index = sym.findNumericAttributeIndexLocked(name, numericVal)
+		} else {
+			index = sym.findAttributeIndexLocked(name, value)
+		}
+		if index == -1 {
+			return nil, false
+		}
+
+		mask[pos] = uint64(index)
+	}
+	return mask, true
+}
+
+// headerPositionLocked returns the combined header position assigned to
+// name, checking sym's own header first and falling through to parent (if
+// any) - the same lookup fillIndexedHeader does implicitly while walking
+// the whole header, narrowed to a single name. Called with sym.mu already
+// held by the caller; see lookupDictIndex for the locking discipline when
+// stepping into parent.
+func (sym *SymTable) headerPositionLocked(name string) (int, bool) {
+	if pos, ok := sym.header[name]; ok {
+		return pos, true
+	}
+	if sym.parent != nil {
+		sym.parent.mu.RLock()
+		defer sym.parent.mu.RUnlock()
+		return sym.parent.headerPositionLocked(name)
+	}
+	return 0, false
+}
+
 // Find the attribute value for the given index. If the attribute having the
-// specified name doesn't exist or the index is out of bounds, return an empty
+// specified name doesn't exist or the index is out of bounds, return an
+// empty string. On a CacheWrap overlay, an index below this table's own
+// valueOffset belongs to the parent's range and is looked up there.
 func (sym *SymTable) FindAttributeValue(name string, index uint64) string {
-	if _, ok := sym.attributeTable[name]; !ok {
-		return ""
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
+	return sym.findAttributeValueLocked(name, index)
+}
+
+// findAttributeValueLocked is FindAttributeValue's body; see
+// findAttributeIndexLocked for why it's split out.
+func (sym *SymTable) findAttributeValueLocked(name string, index uint64) string {
+	if at, ok := sym.attributeTable[name]; ok {
+		if index >= at.valueOffset && index-at.valueOffset < uint64(len(at.encodedValues)) {
+			dictIndex := at.encodedValues[index-at.valueOffset]
+			if dictIndex == c_TombstoneSentinel {
+				return ""
+			}
+			return sym.lookupDictString(dictIndex)
+		}
 	}
 
-	if index >= uint64(len(sym.attributeTable[name].encodedValues)) {
-		return ""
+	if sym.parent != nil {
+		return sym.parent.FindAttributeValue(name, index)
 	}
 
-	dictIndex := sym.attributeTable[name].encodedValues[index]
-	value, ok := sym.dictToString[dictIndex]
+	return ""
+}
+
+// attributeIndexTombstonedLocked reports whether index has been tombstoned
+// (see DeleteAttributeValue) within name's attribute table. Only
+// dictionary-encoded attributes carry tombstones; an index belonging to a
+// numeric attribute, or to an attribute this table doesn't know about at
+// all, is never considered tombstoned.
+func (sym *SymTable) attributeIndexTombstonedLocked(name string, index uint64) bool {
+	at, ok := sym.attributeTable[name]
 	if !ok {
-		return ""
+		if sym.parent != nil {
+			sym.parent.mu.RLock()
+			defer sym.parent.mu.RUnlock()
+			return sym.parent.attributeIndexTombstonedLocked(name, index)
+		}
+		return false
+	}
+
+	if index < at.valueOffset || index-at.valueOffset >= uint64(len(at.encodedValues)) {
+		return false
 	}
 
-	return value
+	return at.encodedValues[index-at.valueOffset] == c_TombstoneSentinel
+}
+
+// FindNumericAttributeValue is the UnsignedNumericValue counterpart to
+// FindAttributeValue: it returns the raw uint64 stored at index rather than
+// a dictionary-resolved string. The bool result is false if the attribute
+// having the specified name doesn't exist or the index is out of bounds.
+func (sym *SymTable) FindNumericAttributeValue(name string, index uint64) (uint64, bool) {
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
+	return sym.findNumericAttributeValueLocked(name, index)
 }
 
-// Return true if the specified other symbol table is the same as this one
-// Two symbol tables are the same if they encode the same symbols and attribute
-// values
+// findNumericAttributeValueLocked is FindNumericAttributeValue's body; see
+// findAttributeIndexLocked for why it's split out.
+func (sym *SymTable) findNumericAttributeValueLocked(name string, index uint64) (uint64, bool) {
+	if at, ok := sym.attributeTable[name]; ok {
+		if index >= at.valueOffset && index-at.valueOffset < uint64(len(at.numericValues)) {
+			return at.numericValues[index-at.valueOffset], true
+		}
+	}
+
+	if sym.parent != nil {
+		return sym.parent.FindNumericAttributeValue(name, index)
+	}
+
+	return 0, false
+}
+
+// Return true if the specified other symbol table is the same as this one.
+// Two symbol tables are the same if every attribute resolves to the same
+// ordered sequence of values once tombstoned entries (see
+// DeleteAttributeValue) are skipped on both sides. Values are compared in
+// their resolved form - the dictionary string for a DictionaryEncodedValue
+// attribute, the raw uint64 for a UnsignedNumericValue one - rather than as
+// raw dictionary indices, since two tables that received the same values
+// through different dictionary histories (one of them having inserted a
+// value the other never saw) hold different raw indices for them. sym and other are locked one at a time rather than
+// together - sym is resolved under its own lock, which is released before
+// other's is taken - so two tables comparing themselves against each other
+// concurrently can't deadlock against each other's locks.
 func (sym *SymTable) IsSame(other *SymTable) bool {
-	if len(sym.dictToString) != len(other.dictToString) {
-		return false
+	type attrSnapshot struct {
+		encodingType  AttributeEncoding
+		values        []string
+		numericValues []uint64
 	}
 
-	for k, v := range sym.dictToString {
-		if other.dictToString[k] != v {
-			return false
+	resolveAttrs := func(t *SymTable) map[string]attrSnapshot {
+		attrs := make(map[string]attrSnapshot, len(t.attributeTable))
+		for name, at := range t.attributeTable {
+			if at.encodingType == UnsignedNumericValue {
+				attrs[name] = attrSnapshot{
+					encodingType:  at.encodingType,
+					numericValues: append([]uint64(nil), at.numericValues...),
+				}
+				continue
+			}
+
+			values := make([]string, 0, len(at.encodedValues))
+			for _, dictIndex := range at.encodedValues {
+				if dictIndex == c_TombstoneSentinel {
+					continue
+				}
+				values = append(values, t.lookupDictString(dictIndex))
+			}
+			attrs[name] = attrSnapshot{encodingType: at.encodingType, values: values}
 		}
+		return attrs
 	}
 
-	if len(sym.attributeTable) != len(other.attributeTable) {
+	sym.mu.RLock()
+	attrs := resolveAttrs(sym)
+	sym.mu.RUnlock()
+
+	other.mu.RLock()
+	defer other.mu.RUnlock()
+	otherAttrs := resolveAttrs(other)
+
+	if len(attrs) != len(otherAttrs) {
 		return false
 	}
 
-	for k, v := range sym.attributeTable {
-		otherV, ok := other.attributeTable[k]
-		if !ok {
+	for name, v := range attrs {
+		otherV, ok := otherAttrs[name]
+		if !ok || v.encodingType != otherV.encodingType {
 			return false
 		}
 
-		if v.encodingType != otherV.encodingType {
-			return false
+		if v.encodingType == UnsignedNumericValue {
+			if len(v.numericValues) != len(otherV.numericValues) {
+				return false
+			}
+			for i, val := range v.numericValues {
+				if val != otherV.numericValues[i] {
+					return false
+				}
+			}
+			continue
 		}
 
-		if len(v.encodedValues) != len(otherV.encodedValues) {
+		if len(v.values) != len(otherV.values) {
 			return false
 		}
 
-		for i, val := range v.encodedValues {
-			if val != otherV.encodedValues[i] {
+		for i, val := range v.values {
+			if val != otherV.values[i] {
 				return false
 			}
 		}
@@ -232,11 +708,24 @@ func (sym *SymTable) IsSame(other *SymTable) bool {
 func (sym *SymTable) UpdateDictionary(
 	attributeValues []string,
 	writeCompleteFn WriteCompletionFn) error {
+	sym.mu.Lock()
+	defer sym.mu.Unlock()
+
+	return sym.updateDictionaryLocked(attributeValues, writeCompleteFn)
+}
+
+// updateDictionaryLocked is UpdateDictionary's body, pulled out so
+// ApplyLocked (which already holds sym.mu, e.g. via Commit promoting a
+// CacheWrap) can reach it without re-locking the same mutex.
+func (sym *SymTable) updateDictionaryLocked(
+	attributeValues []string,
+	writeCompleteFn WriteCompletionFn) error {
+
 	if len(attributeValues) == 0 {
 		return errors.New("attribute values are empty")
 	}
 
-	indexValue := uint64(len(sym.dictToString))
+	indexValue := sym.nextDictIndex()
 	for _, attributeValue := range attributeValues {
 
 		if _, ok := sym.dictToString[indexValue]; ok {
@@ -246,15 +735,18 @@ func (sym *SymTable) UpdateDictionary(
 			return errors.New("index value already exists in symbol table")
 		}
 
-		if _, ok := sym.dictToIndex[attributeValue]; ok {
+		if _, ok := sym.lookupDictIndex(attributeValue); ok {
 			return errors.New("attribute name already exists in symbol table")
 		}
 
 		sym.dictToString[indexValue] = attributeValue
 		sym.dictToIndex[attributeValue] = indexValue
+		sym.contentHash = foldHashString(sym.contentHash, attributeValue)
 		indexValue++
 	}
 
+	sym.recordOp(symTableOp{kind: symTableOpDictionary, dictValues: attributeValues})
+
 	// Update the stream if the table is not finalized and we have a stream
 	// writer attached to this symtable
 	if !sym.finalized && sym.streamWriter != nil {
@@ -289,33 +781,43 @@ func (sym *SymTable) InsertAttributeValue(
 	name string,
 	value string,
 	writeCompleteFn WriteCompletionFn) error {
+	sym.mu.Lock()
+	defer sym.mu.Unlock()
 
-	if _, ok := sym.dictToIndex[value]; !ok {
-		id := uint64(len(sym.dictToIndex))
+	if at, ok := sym.lookupAttributeTable(name); ok && at.encodingType != DictionaryEncodedValue {
+		return errors.New("attribute already exists with a different encoding")
+	}
+
+	if _, ok := sym.lookupDictIndex(value); !ok {
+		id := sym.nextDictIndex()
 		sym.dictToIndex[value] = id
 		sym.dictToString[id] = value
+		sym.contentHash = foldHashString(sym.contentHash, value)
+		sym.recordOp(symTableOp{kind: symTableOpDictionary, dictValues: []string{value}})
 	}
 
 	if _, ok := sym.attributeTable[name]; !ok {
-		sym.attributeTable[name] = &AttributeTable{
-			name:                   name,
-			encodingType:           DictionaryEncodedValue,
-			encodedValues:          make([]uint64, 0, 10),
-			encodedValuesFromIndex: make(map[uint64]uint64),
+		parentAt, parentOk := sym.lookupAttributeTable(name)
+		sym.attributeTable[name] = newAttributeTable(name, DictionaryEncodedValue, parentAt, parentOk)
+		if !parentOk {
+			sym.header[name] = sym.parentHeaderOffset + len(sym.header)
 		}
-		sym.header[name] = len(sym.header)
 	}
 
 	// If the value is not already part of the attribute, make it
-	id := sym.dictToIndex[value]
-	if _, ok := sym.attributeTable[name].encodedValuesFromIndex[id]; !ok {
-		sym.attributeTable[name].encodedValues = append(sym.attributeTable[name].encodedValues, id)
-		sym.attributeTable[name].encodedValuesFromIndex[id] = uint64(len(sym.attributeTable[name].encodedValuesFromIndex))
+	id, _ := sym.lookupDictIndex(value)
+	at := sym.attributeTable[name]
+	if _, ok := at.encodedValuesFromIndex[id]; !ok {
+		at.encodedValues = append(at.encodedValues, id)
+		at.encodedValuesFromIndex[id] = at.valueOffset + uint64(len(at.encodedValuesFromIndex))
+		sym.contentHash = foldHashString(sym.contentHash, name)
+		sym.contentHash = foldHashUint64(sym.contentHash, id)
 	}
 
 	// Update the stream
 	return sym.updateStreamWithAttributeInstructionParam(
 		name,
+		DictionaryEncodedValue,
 		[]uint64{id},
 		writeCompleteFn)
 }
@@ -327,38 +829,206 @@ func (sym *SymTable) InsertAttributeIndices(
 	name string,
 	indices []uint64,
 	writeCompleteFn WriteCompletionFn) error {
+	sym.mu.Lock()
+	defer sym.mu.Unlock()
+
+	return sym.insertAttributeIndicesLocked(name, indices, writeCompleteFn)
+}
+
+// insertAttributeIndicesLocked is InsertAttributeIndices's body, pulled out
+// so ApplyLocked (which already holds sym.mu, e.g. via Commit promoting a
+// CacheWrap) can reach it without re-locking the same mutex.
+func (sym *SymTable) insertAttributeIndicesLocked(
+	name string,
+	indices []uint64,
+	writeCompleteFn WriteCompletionFn) error {
+
+	if at, ok := sym.lookupAttributeTable(name); ok && at.encodingType != DictionaryEncodedValue {
+		return errors.New("attribute already exists with a different encoding")
+	}
+
 	if _, ok := sym.attributeTable[name]; !ok {
-		sym.attributeTable[name] = &AttributeTable{
-			name:                   name,
-			encodingType:           DictionaryEncodedValue,
-			encodedValues:          make([]uint64, 0, 10),
-			encodedValuesFromIndex: make(map[uint64]uint64),
+		parentAt, parentOk := sym.lookupAttributeTable(name)
+		sym.attributeTable[name] = newAttributeTable(name, DictionaryEncodedValue, parentAt, parentOk)
+		if !parentOk {
+			sym.header[name] = sym.parentHeaderOffset + len(sym.header)
 		}
-		sym.header[name] = len(sym.header)
 	}
 
 	// Do a sanity check to make sure the indices are valid	before touching
 	// the symbol table
 	for _, index := range indices {
-		if _, ok := sym.dictToString[index]; !ok {
+		if !sym.dictIndexExists(index) {
 			return errors.New("index value doesn't exist in symbol table")
 		}
 	}
 
 	// Update the foward and reverse mapping
+	at := sym.attributeTable[name]
 	for _, index := range indices {
-		sym.attributeTable[name].encodedValues = append(sym.attributeTable[name].encodedValues, index)
-		sym.attributeTable[name].encodedValuesFromIndex[index] = uint64(len(sym.attributeTable[name].encodedValuesFromIndex))
+		// An index already mapped to this attribute is skipped, the same
+		// way InsertAttributeValue treats an existing value as a NOP.
+		if _, ok := at.encodedValuesFromIndex[index]; ok {
+			continue
+		}
+		at.encodedValues = append(at.encodedValues, index)
+		at.encodedValuesFromIndex[index] = at.valueOffset + uint64(len(at.encodedValuesFromIndex))
+		sym.contentHash = foldHashString(sym.contentHash, name)
+		sym.contentHash = foldHashUint64(sym.contentHash, index)
 	}
 
 	return sym.updateStreamWithAttributeInstructionParam(
 		name,
+		DictionaryEncodedValue,
 		indices,
 		writeCompleteFn)
 }
 
+// InsertNumericAttributeValue inserts value into name's attribute table
+// directly, bypassing the string dictionary entirely - use this in place of
+// InsertAttributeValue for numeric-heavy attributes (timestamps, counters,
+// IDs) whose values would otherwise bloat dictToString/dictToIndex for no
+// benefit. If name already exists with a different encoding, this is an
+// error.
+func (sym *SymTable) InsertNumericAttributeValue(
+	name string,
+	value uint64,
+	writeCompleteFn WriteCompletionFn) error {
+	return sym.InsertNumericAttributeValues(name, []uint64{value}, writeCompleteFn)
+}
+
+// InsertNumericAttributeValues is the UnsignedNumericValue counterpart to
+// InsertAttributeIndices: values are the raw attribute values themselves,
+// appended directly into name's AttributeTable with no intervening
+// dictionary lookup. If name already exists with a different encoding,
+// this is an error.
+func (sym *SymTable) InsertNumericAttributeValues(
+	name string,
+	values []uint64,
+	writeCompleteFn WriteCompletionFn) error {
+	sym.mu.Lock()
+	defer sym.mu.Unlock()
+
+	return sym.insertNumericAttributeValuesLocked(name, values, writeCompleteFn)
+}
+
+// insertNumericAttributeValuesLocked is InsertNumericAttributeValues's
+// body, pulled out so ApplyLocked (which already holds sym.mu, e.g. via
+// Commit promoting a CacheWrap) can reach it without re-locking the same
+// mutex.
+func (sym *SymTable) insertNumericAttributeValuesLocked(
+	name string,
+	values []uint64,
+	writeCompleteFn WriteCompletionFn) error {
+
+	if at, ok := sym.lookupAttributeTable(name); ok && at.encodingType != UnsignedNumericValue {
+		return errors.New("attribute already exists with a different encoding")
+	}
+
+	if _, ok := sym.attributeTable[name]; !ok {
+		parentAt, parentOk := sym.lookupAttributeTable(name)
+		sym.attributeTable[name] = newAttributeTable(name, UnsignedNumericValue, parentAt, parentOk)
+		if !parentOk {
+			sym.header[name] = sym.parentHeaderOffset + len(sym.header)
+		}
+	}
+
+	at := sym.attributeTable[name]
+	for _, value := range values {
+		if _, ok := at.numericValuesFromIndex[value]; ok {
+			continue
+		}
+		at.numericValues = append(at.numericValues, value)
+		at.numericValuesFromIndex[value] = at.valueOffset + uint64(len(at.numericValuesFromIndex))
+		sym.contentHash = foldHashString(sym.contentHash, name)
+		sym.contentHash = foldHashUint64(sym.contentHash, value)
+	}
+
+	return sym.updateStreamWithAttributeInstructionParam(
+		name,
+		UnsignedNumericValue,
+		values,
+		writeCompleteFn)
+}
+
+// DeleteAttributeValue tombstones value within name's attribute table: the
+// value's encodedValues slot is set to c_TombstoneSentinel rather than
+// removed outright, so every other value's index is left undisturbed (see
+// Compact for the operation that actually reclaims the freed space). A
+// WriteDeleteInstruction is recorded through the attached streamWriter the
+// same way InsertAttributeValue records a WriteAttributeInstruction. Once
+// the table has been Finalized, this is an error. If name or value doesn't
+// exist in the symbol table, this is a NOP.
+func (sym *SymTable) DeleteAttributeValue(
+	name string,
+	value string,
+	writeCompleteFn WriteCompletionFn) error {
+	sym.mu.Lock()
+	defer sym.mu.Unlock()
+
+	if sym.finalized {
+		return errors.New("symbol table is finalized")
+	}
+
+	id, ok := sym.lookupDictIndex(value)
+	if !ok {
+		return nil
+	}
+
+	return sym.tombstoneAttributeIndexLocked(name, id, writeCompleteFn)
+}
+
+// DeleteAttributeIndex is DeleteAttributeValue's raw-index counterpart,
+// used to replay a DeleteAttributeValue instruction read back off a
+// SymStreamReader (see BoostSession) without re-resolving the value
+// through the dictionary first.
+func (sym *SymTable) DeleteAttributeIndex(
+	name string,
+	index uint64,
+	writeCompleteFn WriteCompletionFn) error {
+	sym.mu.Lock()
+	defer sym.mu.Unlock()
+
+	if sym.finalized {
+		return errors.New("symbol table is finalized")
+	}
+
+	return sym.tombstoneAttributeIndexLocked(name, index, writeCompleteFn)
+}
+
+// tombstoneAttributeIndexLocked marks dictIndex's entry within name's
+// attribute table as deleted and records the operation, both in this
+// table's own op log (recordOp, so Apply replays it onto a peer) and, if a
+// streamWriter is attached, on the wire. Only name's own AttributeTable is
+// searched, not a CacheWrap parent's: an overlay never mutates its parent
+// directly, so tombstoning a value that only exists on the parent is a
+// NOP, the same way InsertAttributeIndices on an overlay never reaches
+// back to mutate the parent either.
+func (sym *SymTable) tombstoneAttributeIndexLocked(
+	name string,
+	dictIndex uint64,
+	writeCompleteFn WriteCompletionFn) error {
+
+	at, ok := sym.attributeTable[name]
+	if !ok {
+		return nil
+	}
+
+	pos, ok := at.encodedValuesFromIndex[dictIndex]
+	if !ok {
+		return nil
+	}
+
+	at.encodedValues[pos-at.valueOffset] = c_TombstoneSentinel
+	delete(at.encodedValuesFromIndex, dictIndex)
+
+	return sym.updateStreamWithDeleteInstructionParam(name, dictIndex, writeCompleteFn)
+}
+
 // Finalize the symbol table. Once finalized, no more updates can be made
 func (sym *SymTable) Finalize() {
+	sym.mu.Lock()
+	defer sym.mu.Unlock()
 	sym.finalized = true
 	// TODO: Write the End instruction to the stream
 }
@@ -371,28 +1041,428 @@ func (sym *SymTable) Finalize() {
 // timeout is reached. If timeout is 0, wait indefinitely wait for all
 // pending writes to complete.
 func (sym *SymTable) Wait(timeout time.Duration) {
-	if sym.streamWriter != nil {
-		sym.streamWriter.Wait(timeout)
+	sym.mu.RLock()
+	streamWriter := sym.streamWriter
+	sym.mu.RUnlock()
+
+	if streamWriter != nil {
+		streamWriter.Wait(timeout)
+	}
+}
+
+// OpSeqNum returns this table's current position in its own operation log,
+// i.e. the watermark a peer should pass to Iterator once it has applied
+// everything up to and including this value.
+func (sym *SymTable) OpSeqNum() uint32 {
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
+	return sym.opSeqNum
+}
+
+// ContentHash returns a rolling FNV-1a hash over every value this table has
+// ever inserted. Two tables built from the same sequence of inserts (in the
+// same order) report the same ContentHash, so a peer can cheaply check for
+// divergence without an IsSame-style full comparison.
+func (sym *SymTable) ContentHash() uint64 {
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
+	return sym.contentHash
+}
+
+// SymIterator walks a consistent, point-in-time snapshot of a SymTable's
+// columns, captured under a single read lock by NewIterator. Unlike
+// SymTableOpIterator (which replays the operation log for catch-up), a
+// SymIterator is for query code that wants to read the table's current
+// column/value shape without holding a lock for the full walk. Call Next
+// before the first Name/Values call, mirroring SymTableOpIterator's
+// Next-then-read convention.
+type SymIterator interface {
+	// Next advances to the next column. Returns false once every column
+	// captured at NewIterator time has been visited.
+	Next() bool
+
+	// Name returns the current column's attribute name.
+	Name() string
+
+	// Values returns the current column's values, already resolved to
+	// their string form (dictionary-resolved for a DictionaryEncodedValue
+	// column, decimal-formatted for a UnsignedNumericValue one) - see
+	// NewIterator.
+	Values() []string
+}
+
+// symIteratorColumn is one column captured by NewIterator.
+type symIteratorColumn struct {
+	name   string
+	values []string
+}
+
+// symTableIterator is the concrete SymIterator NewIterator returns.
+type symTableIterator struct {
+	columns []symIteratorColumn
+	pos     int
+}
+
+func (it *symTableIterator) Next() bool {
+	it.pos++
+	return it.pos < len(it.columns)
+}
+
+func (it *symTableIterator) Name() string {
+	return it.columns[it.pos].name
+}
+
+func (it *symTableIterator) Values() []string {
+	return it.columns[it.pos].values
+}
+
+// NewIterator captures a consistent snapshot of sym's own header and
+// attribute tables under a single read lock and returns a SymIterator over
+// it, so downstream query code can walk the table's columns without holding
+// a lock (and so blocking writers) for the whole scan. On a CacheWrap
+// overlay, only the overlay's own locally-staged columns are captured - not
+// the parent's - since the overlay is a transient, single-writer batch
+// rather than the kind of long-lived table this is meant for.
+func (sym *SymTable) NewIterator() SymIterator {
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
+
+	names := make([]string, 0, len(sym.header))
+	for name := range sym.header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	columns := make([]symIteratorColumn, 0, len(names))
+	for _, name := range names {
+		at, ok := sym.attributeTable[name]
+		if !ok {
+			continue
+		}
+
+		var values []string
+		if at.encodingType == UnsignedNumericValue {
+			values = make([]string, len(at.numericValues))
+			for i, v := range at.numericValues {
+				values[i] = strconv.FormatUint(v, 10)
+			}
+		} else {
+			values = make([]string, len(at.encodedValues))
+			for i, v := range at.encodedValues {
+				values[i] = sym.lookupDictString(v)
+			}
+		}
+
+		columns = append(columns, symIteratorColumn{name: name, values: values})
 	}
+
+	return &symTableIterator{columns: columns, pos: -1}
+}
+
+// Iterator returns the ordered sequence of dictionary-update and
+// attribute-insert operations recorded since fromOpSeqNum (exclusive), so a
+// peer that has already applied everything up to fromOpSeqNum can catch up
+// via Apply instead of re-fetching the whole table. fromOpSeqNum of 0
+// yields every operation this table has recorded. Returns an error if
+// fromOpSeqNum is ahead of this table's own watermark, which would mean
+// the caller's view is somehow newer than this copy.
+func (sym *SymTable) Iterator(fromOpSeqNum uint32) (*SymTableOpIterator, error) {
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
+	return sym.iteratorLocked(fromOpSeqNum)
+}
+
+// iteratorLocked is Iterator's body, pulled out so Commit (which already
+// holds sym.mu for the overlay it's promoting) can reach it without
+// re-locking the same mutex.
+func (sym *SymTable) iteratorLocked(fromOpSeqNum uint32) (*SymTableOpIterator, error) {
+	if fromOpSeqNum > sym.opSeqNum {
+		return nil, errors.New("fromOpSeqNum is ahead of the symbol table's own watermark")
+	}
+
+	ndx := sort.Search(len(sym.ops), func(i int) bool { return sym.ops[i].seqNum > fromOpSeqNum })
+	return &SymTableOpIterator{ops: sym.ops[ndx:], pos: -1}, nil
+}
+
+// Apply replays the operations yielded by it onto sym, taking the same
+// UpdateDictionary/InsertAttributeIndices code path the original inserts
+// took, so IsSame remains true against the source table afterwards.
+func (sym *SymTable) Apply(it *SymTableOpIterator) error {
+	sym.mu.Lock()
+	defer sym.mu.Unlock()
+
+	return sym.applyLocked(it)
+}
+
+// applyLocked is Apply's body, pulled out so Commit (which already holds
+// sym.parent.mu for the whole version-bump-plus-replay, not just each
+// individual op) can reach it without re-locking the same mutex per op.
+func (sym *SymTable) applyLocked(it *SymTableOpIterator) error {
+	for it.Next() {
+		var err error
+		switch {
+		case it.IsDelete():
+			if sym.finalized {
+				err = errors.New("symbol table is finalized")
+			} else {
+				err = sym.tombstoneAttributeIndexLocked(it.AttributeName(), it.DeletedIndex(), nil)
+			}
+		case it.IsNumericAttribute():
+			err = sym.insertNumericAttributeValuesLocked(it.AttributeName(), it.AttributeIndices(), nil)
+		case it.IsAttribute():
+			err = sym.insertAttributeIndicesLocked(it.AttributeName(), it.AttributeIndices(), nil)
+		default:
+			err = sym.updateDictionaryLocked(it.DictionaryValues(), nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CacheWrap returns a shadow SymTable that stages new dictionary entries
+// and attribute inserts (UpdateDictionary/InsertAttributeValue/
+// InsertAttributeIndices) in its own overlay maps, leaving sym completely
+// untouched until Commit is called. AttributeValueExists, FindAttributeIndex,
+// FindAttributeValue and GetIndexedHeader on the wrap consult the overlay
+// first and fall through to sym. This lets a caller validate and assemble
+// an entire incoming batch - checking it against a dictionaryLimit or
+// cardinality policy via NumSymbols/NumAttributes along the way - before
+// any of it becomes visible on the shared table, and Discard it cleanly if
+// the batch turns out to be invalid.
+//
+// CacheWrap assumes sym isn't mutated while the wrap is open: the wrap's
+// dictionary and attribute indices are reserved against sym's size at wrap
+// time so that Commit, which replays them onto sym unchanged, hands out
+// the exact same indices the wrap already reported to the caller.
+func (sym *SymTable) CacheWrap() *SymTable {
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
+
+	return &SymTable{
+		name:               sym.name,
+		version:            sym.version,
+		dictToString:       make(map[uint64]string),
+		dictToIndex:        make(map[string]uint64),
+		header:             make(map[string]int),
+		attributeTable:     make(map[string]*AttributeTable),
+		contentHash:        c_FNVOffsetBasis64,
+		parent:             sym,
+		parentDictOffset:   sym.combinedDictSize(),
+		parentHeaderOffset: sym.combinedHeaderLen(),
+	}
+}
+
+// Commit promotes every operation staged in this wrap onto the parent it
+// was created from, via the same Iterator/Apply path used to catch up a
+// stale remote copy, then bumps the parent's version once. The version
+// bump also resets the parent's instructionSeqNum to 0, so - if the
+// parent has a streamWriter attached - the first replayed dictionary
+// update re-establishes a fresh InitSymTable at the new version rather
+// than writing an UpdateSymTable under a version nothing ever
+// initialized; this relies on the wrap having staged at least one
+// dictionary update before any attribute insert, the same convention
+// BoostSession already follows for a fresh table. Commit returns an error
+// if called on a SymTable that isn't a CacheWrap. A wrap with nothing
+// staged commits as a NOP and leaves the parent's version unchanged.
+func (sym *SymTable) Commit() error {
+	if sym.parent == nil {
+		return errors.New("Commit called on a SymTable that is not a CacheWrap")
+	}
+
+	sym.mu.RLock()
+	it, err := sym.iteratorLocked(0)
+	sym.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if len(it.ops) == 0 {
+		return nil
+	}
+
+	sym.parent.mu.Lock()
+	defer sym.parent.mu.Unlock()
+
+	sym.parent.version++
+	sym.parent.instructionSeqNum = 0
+
+	return sym.parent.applyLocked(it)
+}
+
+// Discard throws away everything staged in this wrap. Since CacheWrap
+// never mutates the parent, this mostly exists for symmetry with Commit
+// and to free the overlay's maps.
+func (sym *SymTable) Discard() {
+	sym.mu.Lock()
+	defer sym.mu.Unlock()
+
+	sym.dictToString = nil
+	sym.dictToIndex = nil
+	sym.header = nil
+	sym.attributeTable = nil
+	sym.ops = nil
 }
 
 //-----------------
 //- PRIVATE METHODS
 //-----------------
 
+// newAttributeTable creates a fresh AttributeTable for name with the given
+// encoding. If parentAt is given (the attribute already exists somewhere up
+// the CacheWrap chain), the new table's valueOffset continues parentAt's
+// numbering instead of starting at 0; callers are expected to have already
+// checked parentAt.encodingType matches encodingType.
+func newAttributeTable(name string, encodingType AttributeEncoding, parentAt *AttributeTable, ok bool) *AttributeTable {
+	at := &AttributeTable{
+		name:         name,
+		encodingType: encodingType,
+	}
+
+	var parentValueCount uint64
+	if ok {
+		if encodingType == UnsignedNumericValue {
+			parentValueCount = uint64(len(parentAt.numericValuesFromIndex))
+		} else {
+			parentValueCount = uint64(len(parentAt.encodedValuesFromIndex))
+		}
+		at.valueOffset = parentAt.valueOffset + parentValueCount
+	}
+
+	if encodingType == UnsignedNumericValue {
+		at.numericValues = make([]uint64, 0, 10)
+		at.numericValuesFromIndex = make(map[uint64]uint64)
+	} else {
+		at.encodedValues = make([]uint64, 0, 10)
+		at.encodedValuesFromIndex = make(map[uint64]uint64)
+	}
+
+	return at
+}
+
+// combinedDictSize returns the number of dictionary entries visible to sym,
+// counting its own plus (recursively) its parent's. Called with sym.mu
+// already held by the caller; parent's own lock is taken explicitly for the
+// recursive step, since parent's fields aren't covered by sym's lock.
+func (sym *SymTable) combinedDictSize() uint64 {
+	n := uint64(len(sym.dictToString))
+	if sym.parent != nil {
+		sym.parent.mu.RLock()
+		n += sym.parent.combinedDictSize()
+		sym.parent.mu.RUnlock()
+	}
+	return n
+}
+
+// combinedHeaderLen returns the number of attribute columns visible to sym,
+// counting its own plus (recursively) its parent's. See combinedDictSize
+// for the locking discipline.
+func (sym *SymTable) combinedHeaderLen() int {
+	n := len(sym.header)
+	if sym.parent != nil {
+		sym.parent.mu.RLock()
+		n += sym.parent.combinedHeaderLen()
+		sym.parent.mu.RUnlock()
+	}
+	return n
+}
+
+// nextDictIndex returns the index value the next UpdateDictionary/
+// InsertAttributeValue insert should use.
+func (sym *SymTable) nextDictIndex() uint64 {
+	return sym.parentDictOffset + uint64(len(sym.dictToString))
+}
+
+// lookupDictIndex looks up value's dictionary index, checking sym's own
+// dictToIndex first and falling through to parent (if any). Called with
+// sym.mu already held by the caller; see combinedDictSize for the locking
+// discipline when stepping into parent.
+func (sym *SymTable) lookupDictIndex(value string) (uint64, bool) {
+	if id, ok := sym.dictToIndex[value]; ok {
+		return id, true
+	}
+	if sym.parent != nil {
+		sym.parent.mu.RLock()
+		defer sym.parent.mu.RUnlock()
+		return sym.parent.lookupDictIndex(value)
+	}
+	return 0, false
+}
+
+// dictIndexExists reports whether index resolves to a dictionary value in
+// sym or (recursively) its parent. See lookupDictIndex for the locking
+// discipline.
+func (sym *SymTable) dictIndexExists(index uint64) bool {
+	if _, ok := sym.dictToString[index]; ok {
+		return true
+	}
+	if sym.parent != nil {
+		sym.parent.mu.RLock()
+		defer sym.parent.mu.RUnlock()
+		return sym.parent.dictIndexExists(index)
+	}
+	return false
+}
+
+// lookupDictString resolves a dictionary index to its value, checking sym's
+// own dictToString first and falling through to parent (if any). See
+// lookupDictIndex for the locking discipline.
+func (sym *SymTable) lookupDictString(index uint64) string {
+	if value, ok := sym.dictToString[index]; ok {
+		return value
+	}
+	if sym.parent != nil {
+		sym.parent.mu.RLock()
+		defer sym.parent.mu.RUnlock()
+		return sym.parent.lookupDictString(index)
+	}
+	return ""
+}
+
+// lookupAttributeTable looks up name's AttributeTable, checking sym's own
+// attributeTable first and falling through to parent (if any). See
+// lookupDictIndex for the locking discipline.
+func (sym *SymTable) lookupAttributeTable(name string) (*AttributeTable, bool) {
+	if at, ok := sym.attributeTable[name]; ok {
+		return at, true
+	}
+	if sym.parent != nil {
+		sym.parent.mu.RLock()
+		defer sym.parent.mu.RUnlock()
+		return sym.parent.lookupAttributeTable(name)
+	}
+	return nil, false
+}
+
+// recordOp appends op to this table's operation log, stamping it with the
+// next opSeqNum.
+func (sym *SymTable) recordOp(op symTableOp) {
+	sym.opSeqNum++
+	op.seqNum = sym.opSeqNum
+	sym.ops = append(sym.ops, op)
+}
+
 // Update the stream if the table is not finalized and we have a stream
 // writer attached to this symtable
 func (sym *SymTable) updateStreamWithAttributeInstructionParam(
 	name string,
+	encodingType AttributeEncoding,
 	indices []uint64,
 	writeCompleteFn WriteCompletionFn) error {
 
+	opKind := symTableOpAttribute
+	if encodingType == UnsignedNumericValue {
+		opKind = symTableOpNumericAttribute
+	}
+	sym.recordOp(symTableOp{kind: opKind, attrName: name, indices: indices})
+
 	if sym.streamWriter != nil && !sym.finalized {
 		err := sym.streamWriter.WriteAttributeInstruction(
 			sym.version,
 			sym.instructionSeqNum+1,
 			name,
-			DictionaryEncodedValue,
+			encodingType,
 			indices,
 			writeCompleteFn)
 		if err != nil {
@@ -405,3 +1475,121 @@ func (sym *SymTable) updateStreamWithAttributeInstructionParam(
 
 	return nil
 }
+
+// updateStreamWithDeleteInstructionParam is
+// updateStreamWithAttributeInstructionParam's DeleteAttributeValue
+// counterpart: it records the tombstone in this table's own operation log
+// and, if the table is not finalized and has a stream writer attached,
+// writes it through as a WriteDeleteInstruction.
+func (sym *SymTable) updateStreamWithDeleteInstructionParam(
+	name string,
+	index uint64,
+	writeCompleteFn WriteCompletionFn) error {
+
+	sym.recordOp(symTableOp{kind: symTableOpDelete, attrName: name, deletedIndex: index})
+
+	if sym.streamWriter != nil && !sym.finalized {
+		err := sym.streamWriter.WriteDeleteInstruction(
+			sym.version,
+			sym.instructionSeqNum+1,
+			name,
+			index,
+			writeCompleteFn)
+		if err != nil {
+			return err
+		}
+
+		// Update the sequence number
+		sym.instructionSeqNum++
+	}
+
+	return nil
+}
+
+// CompactionRemap records, for one dictionary-encoded attribute, the
+// mapping from every surviving value's old index to its new index after
+// Compact. A caller holding a cached GetIndexedHeader result uses this to
+// rewrite the header values belonging to that attribute's column against
+// the compacted table.
+type CompactionRemap map[uint64]uint64
+
+// Compact returns a new SymTable with every attribute's tombstoned values
+// (see DeleteAttributeValue) dropped and its surviving value indices
+// re-densified, so a long-lived table with churny attributes doesn't carry
+// tombstoned slots forever. The shared dictionary (dictToString/
+// dictToIndex) is copied across unchanged - dropping an orphaned dictionary
+// entry would require scanning every other attribute to prove nothing else
+// still references it, and compaction is only about the per-attribute
+// index space GetIndexedHeader/FindAttributeIndex hand out, which is where
+// the tombstones actually cost space. The returned map is keyed by
+// attribute name and gives, for each dictionary-encoded attribute, the
+// old->new index mapping a caller must apply to rewrite any
+// GetIndexedHeader result cached against sym. Numeric attributes have no
+// tombstone concept and are copied across with no remap entry. sym itself
+// is left untouched; Compact doesn't require Finalize to have been called
+// first.
+func (sym *SymTable) Compact() (*SymTable, map[string]CompactionRemap, error) {
+	sym.mu.RLock()
+	defer sym.mu.RUnlock()
+
+	compacted := &SymTable{
+		name:           sym.name,
+		version:        sym.version,
+		dictToString:   make(map[uint64]string, len(sym.dictToString)),
+		dictToIndex:    make(map[string]uint64, len(sym.dictToIndex)),
+		header:         make(map[string]int, len(sym.header)),
+		attributeTable: make(map[string]*AttributeTable, len(sym.attributeTable)),
+		contentHash:    c_FNVOffsetBasis64,
+	}
+
+	for id, value := range sym.dictToString {
+		compacted.dictToString[id] = value
+		compacted.contentHash = foldHashString(compacted.contentHash, value)
+	}
+	for value, id := range sym.dictToIndex {
+		compacted.dictToIndex[value] = id
+	}
+	for name, i := range sym.header {
+		compacted.header[name] = i
+	}
+
+	remap := make(map[string]CompactionRemap, len(sym.attributeTable))
+
+	for name, at := range sym.attributeTable {
+		newAt := &AttributeTable{name: name, encodingType: at.encodingType}
+
+		if at.encodingType == UnsignedNumericValue {
+			newAt.numericValues = append([]uint64(nil), at.numericValues...)
+			newAt.numericValuesFromIndex = make(map[uint64]uint64, len(at.numericValuesFromIndex))
+			for value, index := range at.numericValuesFromIndex {
+				newAt.numericValuesFromIndex[value] = index
+			}
+			compacted.attributeTable[name] = newAt
+			continue
+		}
+
+		newAt.encodedValues = make([]uint64, 0, len(at.encodedValues))
+		newAt.encodedValuesFromIndex = make(map[uint64]uint64, len(at.encodedValuesFromIndex))
+		attrRemap := make(CompactionRemap, len(at.encodedValues))
+
+		for pos, dictIndex := range at.encodedValues {
+			oldIndex := at.valueOffset + uint64(pos)
+			if dictIndex == c_TombstoneSentinel {
+				continue
+			}
+
+			newIndex := uint64(len(newAt.encodedValues))
+			newAt.encodedValues = append(newAt.encodedValues, dictIndex)
+			newAt.encodedValuesFromIndex[dictIndex] = newIndex
+			attrRemap[oldIndex] = newIndex
+
+			compacted.contentHash = foldHashString(compacted.contentHash, name)
+			compacted.contentHash = foldHashUint64(compacted.contentHash, dictIndex)
+		}
+
+		compacted.attributeTable[name] = newAt
+		remap[name] = attrRemap
+	}
+
+	return compacted, remap, nil
+}
@@ -1,6 +1,9 @@
 package core
 
 import (
+	"bytes"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -193,3 +196,430 @@ func TestSymTableSame(t *testing.T) {
 	otherTable.InsertAttributeValue("dst", attributeValues[0], nil)
 	require.False(t, symTable.IsSame(otherTable))
 }
+
+func TestSymTableCacheWrapCommit(t *testing.T) {
+	symTable := NewSymTable("test", 1, nil)
+	require.NoError(t, symTable.UpdateDictionary([]string{"a", "b"}, nil))
+	symTable.InsertAttributeValue("host", "a", nil)
+
+	wrap := symTable.CacheWrap()
+
+	// Values already on the parent are visible through the wrap.
+	require.True(t, wrap.AttributeValueExists("a"))
+	require.Equal(t, 0, wrap.FindAttributeIndex("host", "a"))
+
+	// Stage a new value. It must not be visible on the parent yet.
+	require.NoError(t, wrap.UpdateDictionary([]string{"c"}, nil))
+	wrap.InsertAttributeValue("host", "c", nil)
+	require.False(t, symTable.AttributeValueExists("c"))
+	require.Equal(t, -1, symTable.FindAttributeIndex("host", "c"))
+
+	// But it is visible through the wrap itself, continuing the parent's
+	// index numbering rather than restarting at 0.
+	require.True(t, wrap.AttributeValueExists("c"))
+	require.Equal(t, 1, wrap.FindAttributeIndex("host", "c"))
+
+	indexedHeader, hasMissing := wrap.GetIndexedHeader(map[string]string{"host": "c"})
+	require.Equal(t, 1, len(indexedHeader))
+	require.Equal(t, 1, indexedHeader[0])
+	require.False(t, hasMissing)
+
+	parentVersion := symTable.Version()
+	require.NoError(t, wrap.Commit())
+
+	// After Commit, the parent sees everything the wrap staged, at the
+	// same index the wrap already reported.
+	require.True(t, symTable.AttributeValueExists("c"))
+	require.Equal(t, 1, symTable.FindAttributeIndex("host", "c"))
+	require.Equal(t, parentVersion+1, symTable.Version())
+}
+
+// TestSymTableCacheWrapUpdateDictionaryExistingParentValue verifies that
+// UpdateDictionary on a wrap treats a value the parent already owns as an
+// error rather than silently assigning it a second, conflicting index -
+// exactly like InsertAttributeValue/InsertAttributeIndices already do.
+func TestSymTableCacheWrapUpdateDictionaryExistingParentValue(t *testing.T) {
+	symTable := NewSymTable("test", 1, nil)
+	require.NoError(t, symTable.UpdateDictionary([]string{"a"}, nil))
+
+	wrap := symTable.CacheWrap()
+	require.Error(t, wrap.UpdateDictionary([]string{"a"}, nil))
+
+	// The wrap didn't stage a second, divergent dictionary entry for "a".
+	require.True(t, wrap.AttributeValueExists("a"))
+	parentVersion := symTable.Version()
+	require.NoError(t, wrap.Commit())
+	require.Equal(t, parentVersion, symTable.Version())
+}
+
+func TestSymTableCacheWrapDiscard(t *testing.T) {
+	symTable := NewSymTable("test", 1, nil)
+	require.NoError(t, symTable.UpdateDictionary([]string{"a"}, nil))
+
+	wrap := symTable.CacheWrap()
+	require.NoError(t, wrap.UpdateDictionary([]string{"z"}, nil))
+	wrap.Discard()
+
+	require.False(t, symTable.AttributeValueExists("z"))
+}
+
+func TestSymTableNumericAttribute(t *testing.T) {
+	symTable := NewSymTable("test", 1, nil)
+	require.NotNil(t, symTable)
+
+	require.NoError(t, symTable.InsertNumericAttributeValue("ts", 1000, nil))
+	require.Equal(t, 0, symTable.FindNumericAttributeIndex("ts", 1000))
+	// A value not yet inserted isn't found.
+	require.Equal(t, -1, symTable.FindNumericAttributeIndex("ts", 2000))
+
+	require.NoError(t, symTable.InsertNumericAttributeValue("ts", 2000, nil))
+	require.Equal(t, 1, symTable.FindNumericAttributeIndex("ts", 2000))
+	// Previous index is unaffected.
+	require.Equal(t, 0, symTable.FindNumericAttributeIndex("ts", 1000))
+
+	value, ok := symTable.FindNumericAttributeValue("ts", 0)
+	require.True(t, ok)
+	require.Equal(t, uint64(1000), value)
+
+	value, ok = symTable.FindNumericAttributeValue("ts", 1)
+	require.True(t, ok)
+	require.Equal(t, uint64(2000), value)
+
+	_, ok = symTable.FindNumericAttributeValue("ts", 2)
+	require.False(t, ok)
+
+	// Inserting the same value again is a no-op, not a new index.
+	require.NoError(t, symTable.InsertNumericAttributeValue("ts", 1000, nil))
+	require.Equal(t, 0, symTable.FindNumericAttributeIndex("ts", 1000))
+
+	// A numeric attribute never touches the string dictionary.
+	require.False(t, symTable.AttributeValueExists("1000"))
+
+	// GetIndexedHeader/GetAttributesFromIndexedHeader round-trip the value
+	// through its decimal string form.
+	indexedHeader, hasMissing := symTable.GetIndexedHeader(map[string]string{"ts": "2000"})
+	require.False(t, hasMissing)
+	require.Equal(t, 1, len(indexedHeader))
+	require.Equal(t, 1, indexedHeader[0])
+
+	attributes := symTable.GetAttributesFromIndexedHeader(indexedHeader)
+	require.Equal(t, "2000", attributes["ts"])
+
+	// Reusing the same name with the string-dictionary API is an error.
+	require.Error(t, symTable.InsertAttributeValue("ts", "x", nil))
+	require.Error(t, symTable.InsertAttributeIndices("ts", []uint64{0}, nil))
+
+	// And the reverse: a dictionary-encoded attribute can't be reused as
+	// numeric.
+	require.NoError(t, symTable.InsertAttributeValue("host", "a", nil))
+	require.Error(t, symTable.InsertNumericAttributeValue("host", 1, nil))
+}
+
+func TestSymTableSnapshotRoundTrip(t *testing.T) {
+	symTable := NewSymTable("test", 3, nil)
+	require.NotNil(t, symTable)
+
+	require.NoError(t, symTable.InsertAttributeValue("host", "a", nil))
+	require.NoError(t, symTable.InsertAttributeValue("host", "b", nil))
+	require.NoError(t, symTable.InsertAttributeValue("host", "a", nil))
+	require.NoError(t, symTable.InsertNumericAttributeValue("ts", 1000, nil))
+	require.NoError(t, symTable.InsertNumericAttributeValue("ts", 2000, nil))
+	symTable.Finalize()
+
+	var buf bytes.Buffer
+	require.NoError(t, symTable.WriteSnapshot(&buf))
+
+	loaded, err := LoadSymTableSnapshot(&buf, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, symTable.Name(), loaded.Name())
+	require.Equal(t, symTable.Version(), loaded.Version())
+	require.True(t, symTable.IsSame(loaded))
+
+	// The loaded table round-trips values through the same public API.
+	require.Equal(t, 0, loaded.FindAttributeIndex("host", "a"))
+	require.Equal(t, 1, loaded.FindAttributeIndex("host", "b"))
+	require.Equal(t, 0, loaded.FindNumericAttributeIndex("ts", 1000))
+	require.Equal(t, 1, loaded.FindNumericAttributeIndex("ts", 2000))
+
+	header, hasMissing := loaded.GetIndexedHeader(map[string]string{"host": "b", "ts": "2000"})
+	require.False(t, hasMissing)
+	attributes := loaded.GetAttributesFromIndexedHeader(header)
+	require.Equal(t, "b", attributes["host"])
+	require.Equal(t, "2000", attributes["ts"])
+}
+
+func TestSymTableSnapshotRejectsCorruption(t *testing.T) {
+	symTable := NewSymTable("test", 1, nil)
+	require.NoError(t, symTable.InsertAttributeValue("host", "a", nil))
+
+	var buf bytes.Buffer
+	require.NoError(t, symTable.WriteSnapshot(&buf))
+
+	corrupted := buf.Bytes()
+	corrupted[len(corrupted)-1] ^= 0xFF
+
+	_, err := LoadSymTableSnapshot(bytes.NewReader(corrupted), nil)
+	require.Error(t, err)
+}
+
+func TestSymTableSnapshotRejectsCacheWrap(t *testing.T) {
+	symTable := NewSymTable("test", 1, nil)
+	require.NoError(t, symTable.InsertAttributeValue("host", "a", nil))
+
+	wrap := symTable.CacheWrap()
+
+	var buf bytes.Buffer
+	require.Error(t, wrap.WriteSnapshot(&buf))
+}
+
+func TestSymTableNewIterator(t *testing.T) {
+	symTable := NewSymTable("test", 1, nil)
+	require.NotNil(t, symTable)
+
+	require.NoError(t, symTable.InsertAttributeValue("host", "b", nil))
+	require.NoError(t, symTable.InsertAttributeValue("host", "a", nil))
+	require.NoError(t, symTable.InsertNumericAttributeValue("ts", 2000, nil))
+	require.NoError(t, symTable.InsertNumericAttributeValue("ts", 1000, nil))
+
+	it := symTable.NewIterator()
+
+	require.True(t, it.Next())
+	require.Equal(t, "host", it.Name())
+	require.Equal(t, []string{"b", "a"}, it.Values())
+
+	require.True(t, it.Next())
+	require.Equal(t, "ts", it.Name())
+	require.Equal(t, []string{"2000", "1000"}, it.Values())
+
+	require.False(t, it.Next())
+}
+
+func TestSymTableNewIteratorOnCacheWrapOnlyCoversOverlay(t *testing.T) {
+	symTable := NewSymTable("test", 1, nil)
+	require.NoError(t, symTable.InsertAttributeValue("host", "a", nil))
+
+	wrap := symTable.CacheWrap()
+	require.NoError(t, wrap.InsertAttributeValue("region", "us-east", nil))
+
+	it := wrap.NewIterator()
+
+	require.True(t, it.Next())
+	require.Equal(t, "region", it.Name())
+	require.Equal(t, []string{"us-east"}, it.Values())
+
+	require.False(t, it.Next())
+}
+
+// TestSymTableConcurrentAccess exercises concurrent writers and readers
+// against the same SymTable, the scenario mu was added to make safe. It
+// doesn't assert anything beyond "didn't panic/race" - the Go race
+// detector (go test -race) is what actually proves the locking is correct.
+func TestSymTableConcurrentAccess(t *testing.T) {
+	symTable := NewSymTable("test", 1, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			value := strconv.Itoa(n)
+			for j := 0; j < 100; j++ {
+				require.NoError(t, symTable.InsertAttributeValue("host", value, nil))
+				require.NoError(t, symTable.InsertNumericAttributeValue("ts", uint64(n*100+j), nil))
+			}
+		}(i)
+	}
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				symTable.AttributeValueExists("0")
+				symTable.FindAttributeIndex("host", "0")
+				symTable.GetIndexedHeader(map[string]string{"host": "0"})
+				it := symTable.NewIterator()
+				for it.Next() {
+					it.Name()
+					it.Values()
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestSymTableDeleteAttributeValue(t *testing.T) {
+	symTable := NewSymTable("test", 1, nil)
+
+	require.NoError(t, symTable.InsertAttributeValue("host", "a", nil))
+	require.NoError(t, symTable.InsertAttributeValue("host", "b", nil))
+	require.NoError(t, symTable.InsertAttributeValue("host", "c", nil))
+	require.Equal(t, 1, symTable.FindAttributeIndex("host", "b"))
+
+	require.NoError(t, symTable.DeleteAttributeValue("host", "b", nil))
+
+	// The tombstoned value no longer resolves either way...
+	require.Equal(t, -1, symTable.FindAttributeIndex("host", "b"))
+	require.Equal(t, "", symTable.FindAttributeValue("host", 1))
+
+	// ...but the other values' indices are left undisturbed.
+	require.Equal(t, 0, symTable.FindAttributeIndex("host", "a"))
+	require.Equal(t, 2, symTable.FindAttributeIndex("host", "c"))
+	require.Equal(t, "a", symTable.FindAttributeValue("host", 0))
+	require.Equal(t, "c", symTable.FindAttributeValue("host", 2))
+
+	// Deleting something that was never inserted is a NOP, not an error.
+	require.NoError(t, symTable.DeleteAttributeValue("host", "nope", nil))
+	require.NoError(t, symTable.DeleteAttributeValue("nosuchattribute", "a", nil))
+
+	// Once finalized, no further deletes are allowed.
+	symTable.Finalize()
+	require.Error(t, symTable.DeleteAttributeValue("host", "a", nil))
+}
+
+// TestSymTableDeleteAttributeValueSkippedByIndexedHeader verifies that a
+// tombstoned column is omitted entirely from GetAttributesFromIndexedHeader
+// rather than resolved to an empty string.
+func TestSymTableDeleteAttributeValueSkippedByIndexedHeader(t *testing.T) {
+	symTable := NewSymTable("test", 1, nil)
+
+	require.NoError(t, symTable.InsertAttributeValue("host", "a", nil))
+	require.NoError(t, symTable.InsertAttributeValue("region", "us-east", nil))
+
+	header, hasMissing := symTable.GetIndexedHeader(map[string]string{"host": "a", "region": "us-east"})
+	require.False(t, hasMissing)
+
+	attributes := symTable.GetAttributesFromIndexedHeader(header)
+	require.Equal(t, "a", attributes["host"])
+	require.Equal(t, "us-east", attributes["region"])
+
+	require.NoError(t, symTable.DeleteAttributeValue("host", "a", nil))
+	attributes = symTable.GetAttributesFromIndexedHeader(header)
+	_, ok := attributes["host"]
+	require.False(t, ok)
+	require.Equal(t, "us-east", attributes["region"])
+}
+
+// TestSymTableResolvePredicateMask verifies that the returned mask agrees
+// with an equivalent GetIndexedHeader/GetAttributesFromIndexedHeader round
+// trip for a matching row, and that an unknown column or value is reported
+// via ok rather than a mask entry.
+func TestSymTableResolvePredicateMask(t *testing.T) {
+	symTable := NewSymTable("test", 1, nil)
+
+	require.NoError(t, symTable.InsertAttributeValue("host", "a", nil))
+	require.NoError(t, symTable.InsertAttributeValue("region", "us-east", nil))
+
+	header, hasMissing := symTable.GetIndexedHeader(map[string]string{"host": "a", "region": "us-east"})
+	require.False(t, hasMissing)
+
+	mask, ok := symTable.ResolvePredicateMask(map[string]string{"host": "a"})
+	require.True(t, ok)
+	require.Len(t, mask, 1)
+	for pos, index := range mask {
+		require.Equal(t, header[pos], int(index))
+	}
+
+	_, ok = symTable.ResolvePredicateMask(map[string]string{"host": "crap"})
+	require.False(t, ok)
+
+	_, ok = symTable.ResolvePredicateMask(map[string]string{"missing-attribute": "a"})
+	require.False(t, ok)
+}
+
+// TestSymTableIsSameIgnoresTombstones checks that two tables built by the
+// same sequence of inserts, but where one of them went on to delete a value
+// the other never inserted in the first place, are still considered the
+// same.
+func TestSymTableIsSameIgnoresTombstones(t *testing.T) {
+	symTable := NewSymTable("test", 1, nil)
+	otherTable := NewSymTable("test2", 2, nil)
+
+	require.NoError(t, symTable.InsertAttributeValue("host", "a", nil))
+	require.NoError(t, symTable.InsertAttributeValue("host", "b", nil))
+	require.NoError(t, symTable.InsertAttributeValue("host", "c", nil))
+	require.NoError(t, otherTable.InsertAttributeValue("host", "a", nil))
+	require.NoError(t, otherTable.InsertAttributeValue("host", "c", nil))
+
+	// otherTable never had "b" at all; symTable had it and deleted it. Both
+	// should resolve to the same visible sequence: ["a", "c"].
+	require.NoError(t, symTable.DeleteAttributeValue("host", "b", nil))
+	require.True(t, symTable.IsSame(otherTable))
+
+	require.NoError(t, symTable.DeleteAttributeValue("host", "a", nil))
+	require.False(t, symTable.IsSame(otherTable))
+}
+
+func TestSymTableCompact(t *testing.T) {
+	symTable := NewSymTable("test", 1, nil)
+
+	require.NoError(t, symTable.InsertAttributeValue("host", "a", nil))
+	require.NoError(t, symTable.InsertAttributeValue("host", "b", nil))
+	require.NoError(t, symTable.InsertAttributeValue("host", "c", nil))
+	require.NoError(t, symTable.InsertNumericAttributeValue("ts", 1000, nil))
+	require.NoError(t, symTable.InsertNumericAttributeValue("ts", 2000, nil))
+
+	require.NoError(t, symTable.DeleteAttributeValue("host", "b", nil))
+
+	compacted, remap, err := symTable.Compact()
+	require.NoError(t, err)
+	require.NotNil(t, compacted)
+
+	// The tombstoned value is gone and "c" has been re-densified down into
+	// the slot "b" used to occupy.
+	require.Equal(t, 0, compacted.FindAttributeIndex("host", "a"))
+	require.Equal(t, 1, compacted.FindAttributeIndex("host", "c"))
+	require.Equal(t, -1, compacted.FindAttributeIndex("host", "b"))
+
+	// The caller-facing remap says exactly that: "a" kept its old index,
+	// "c" moved from 2 down to 1, and "b" (tombstoned) isn't in the map.
+	hostRemap, ok := remap["host"]
+	require.True(t, ok)
+	require.Equal(t, uint64(0), hostRemap[0])
+	require.Equal(t, uint64(1), hostRemap[2])
+	_, deleted := hostRemap[1]
+	require.False(t, deleted)
+
+	// Numeric attributes have no tombstone concept, so they're unaffected.
+	require.Equal(t, 0, compacted.FindNumericAttributeIndex("ts", 1000))
+	require.Equal(t, 1, compacted.FindNumericAttributeIndex("ts", 2000))
+
+	// Compact is equivalence-preserving: the compacted table still resolves
+	// to the same visible values as the source, modulo the renumbering the
+	// remap already accounts for.
+	require.True(t, symTable.IsSame(compacted))
+
+	// sym itself is untouched.
+	require.Equal(t, 0, symTable.FindAttributeIndex("host", "a"))
+	require.Equal(t, 2, symTable.FindAttributeIndex("host", "c"))
+}
+
+// TestSymTableSnapshotRoundTripWithTombstone confirms that a tombstoned
+// attribute value survives a WriteSnapshot/LoadSymTableSnapshot round trip:
+// the bit-packing used for dictionary-encoded attributes has to special-case
+// the tombstone sentinel, since it falls far outside the range a dictionary
+// index normally occupies.
+func TestSymTableSnapshotRoundTripWithTombstone(t *testing.T) {
+	symTable := NewSymTable("test", 1, nil)
+
+	require.NoError(t, symTable.InsertAttributeValue("host", "a", nil))
+	require.NoError(t, symTable.InsertAttributeValue("host", "b", nil))
+	require.NoError(t, symTable.InsertAttributeValue("host", "c", nil))
+	require.NoError(t, symTable.DeleteAttributeValue("host", "b", nil))
+	symTable.Finalize()
+
+	var buf bytes.Buffer
+	require.NoError(t, symTable.WriteSnapshot(&buf))
+
+	loaded, err := LoadSymTableSnapshot(&buf, nil)
+	require.NoError(t, err)
+
+	require.True(t, symTable.IsSame(loaded))
+	require.Equal(t, 0, loaded.FindAttributeIndex("host", "a"))
+	require.Equal(t, 2, loaded.FindAttributeIndex("host", "c"))
+	require.Equal(t, -1, loaded.FindAttributeIndex("host", "b"))
+	require.Equal(t, "", loaded.FindAttributeValue("host", 1))
+}
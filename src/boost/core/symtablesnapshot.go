@@ -0,0 +1,521 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math/bits"
+	"sort"
+)
+
+// symtablesnapshot.go implements a self-describing binary snapshot format for
+// SymTable, so a long-lived series family can persist and reload its symbol
+// table without replaying every instruction from the stream. The format is a
+// fixed magic/version pair followed by a sequence of length-prefixed,
+// CRC32C-checked sections: a header section, a dictionary section, a column
+// (header) section, then one section per AttributeTable. Sections are framed
+// independently so a reader can detect a truncated or corrupted snapshot at
+// the point it occurs rather than misinterpreting the bytes that follow.
+
+const (
+	c_SymTableSnapshotMagic   uint32 = 0x53544233 // "STB3"
+	c_SymTableSnapshotVersion uint16 = 1
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// WriteSnapshot writes a self-describing snapshot of sym to w, suitable for
+// reloading via LoadSymTableSnapshot without replaying sym's instruction
+// history. Only a root table can be snapshotted; call Commit (or Discard) on
+// a CacheWrap overlay first.
+func (sym *SymTable) WriteSnapshot(w io.Writer) error {
+	if sym.parent != nil {
+		return errors.New("cannot snapshot a CacheWrap overlay, commit it first")
+	}
+
+	var preamble [6]byte
+	binary.LittleEndian.PutUint32(preamble[0:4], c_SymTableSnapshotMagic)
+	binary.LittleEndian.PutUint16(preamble[4:6], c_SymTableSnapshotVersion)
+	if _, err := w.Write(preamble[:]); err != nil {
+		return err
+	}
+
+	if err := writeFramedSnapshotSection(w, sym.encodeSnapshotHeader()); err != nil {
+		return err
+	}
+	if err := writeFramedSnapshotSection(w, sym.encodeSnapshotDictionary()); err != nil {
+		return err
+	}
+	if err := writeFramedSnapshotSection(w, sym.encodeSnapshotColumns()); err != nil {
+		return err
+	}
+
+	// Attribute tables are written in name order so a snapshot of the same
+	// table always produces the same bytes.
+	names := make([]string, 0, len(sym.attributeTable))
+	for name := range sym.attributeTable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		payload := sym.encodeSnapshotAttributeTable(sym.attributeTable[name])
+		if err := writeFramedSnapshotSection(w, payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadSymTableSnapshot reconstructs a SymTable from a snapshot written by
+// WriteSnapshot, attaching streamWriter (which may be nil) to the result.
+// The loaded table's instructionSeqNum is restored to the value it held at
+// snapshot time, so the next stream write through streamWriter continues the
+// sequence rather than starting over.
+func LoadSymTableSnapshot(r io.Reader, streamWriter SymStreamWriter) (*SymTable, error) {
+	var preamble [6]byte
+	if _, err := io.ReadFull(r, preamble[:]); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(preamble[0:4]) != c_SymTableSnapshotMagic {
+		return nil, errors.New("not a symbol table snapshot")
+	}
+	if binary.LittleEndian.Uint16(preamble[4:6]) != c_SymTableSnapshotVersion {
+		return nil, errors.New("unsupported symbol table snapshot version")
+	}
+
+	headerPayload, err := readFramedSnapshotSection(r)
+	if err != nil {
+		return nil, err
+	}
+	name, version, instructionSeqNum, finalized, err := decodeSnapshotHeader(headerPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	sym := NewSymTable(name, version, streamWriter)
+
+	dictPayload, err := readFramedSnapshotSection(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := sym.decodeSnapshotDictionary(dictPayload); err != nil {
+		return nil, err
+	}
+
+	columnsPayload, err := readFramedSnapshotSection(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := sym.decodeSnapshotColumns(columnsPayload); err != nil {
+		return nil, err
+	}
+
+	for {
+		attrPayload, err := readFramedSnapshotSection(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := sym.decodeSnapshotAttributeTable(attrPayload); err != nil {
+			return nil, err
+		}
+	}
+
+	sym.instructionSeqNum = instructionSeqNum
+	sym.finalized = finalized
+
+	return sym, nil
+}
+
+// writeFramedSnapshotSection writes payload prefixed with its length and
+// trailed with a CRC32C of its bytes, so a corrupt or truncated section is
+// caught on load instead of silently misread.
+func writeFramedSnapshotSection(w io.Writer, payload []byte) error {
+	var lenBuf [4]byte
+	binary.LittleEndian.PutUint32(lenBuf[:], uint32(len(payload)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+
+	var crcBuf [4]byte
+	binary.LittleEndian.PutUint32(crcBuf[:], crc32.Checksum(payload, crc32cTable))
+	_, err := w.Write(crcBuf[:])
+	return err
+}
+
+// readFramedSnapshotSection is the inverse of writeFramedSnapshotSection.
+// Returns io.EOF (unwrapped) if r is exhausted before the section's length
+// prefix, so callers reading a variable number of trailing sections can loop
+// until EOF.
+func readFramedSnapshotSection(r io.Reader) ([]byte, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("symbol table snapshot truncated mid-section")
+		}
+		return nil, err
+	}
+
+	payload := make([]byte, binary.LittleEndian.Uint32(lenBuf[:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, errors.New("symbol table snapshot truncated mid-section")
+	}
+
+	var crcBuf [4]byte
+	if _, err := io.ReadFull(r, crcBuf[:]); err != nil {
+		return nil, errors.New("symbol table snapshot truncated mid-section")
+	}
+	if binary.LittleEndian.Uint32(crcBuf[:]) != crc32.Checksum(payload, crc32cTable) {
+		return nil, errors.New("symbol table snapshot section failed crc32c check")
+	}
+
+	return payload, nil
+}
+
+// encodeSnapshotHeader encodes the fixed header section: name, version,
+// instructionSeqNum and the finalized flag.
+func (sym *SymTable) encodeSnapshotHeader() []byte {
+	buf := make([]byte, 2+len(sym.name)+2+4+1)
+	ndx := 0
+	binary.LittleEndian.PutUint16(buf[ndx:], uint16(len(sym.name)))
+	ndx += 2
+	copy(buf[ndx:], sym.name)
+	ndx += len(sym.name)
+	binary.LittleEndian.PutUint16(buf[ndx:], sym.version)
+	ndx += 2
+	binary.LittleEndian.PutUint32(buf[ndx:], sym.instructionSeqNum)
+	ndx += 4
+	if sym.finalized {
+		buf[ndx] = 1
+	}
+	return buf
+}
+
+// decodeSnapshotHeader is the inverse of encodeSnapshotHeader.
+func decodeSnapshotHeader(payload []byte) (string, uint16, uint32, bool, error) {
+	if len(payload) < 2 {
+		return "", 0, 0, false, errors.New("invalid symbol table snapshot header")
+	}
+	nameLen := binary.LittleEndian.Uint16(payload)
+	payload = payload[2:]
+	if len(payload) < int(nameLen)+2+4+1 {
+		return "", 0, 0, false, errors.New("invalid symbol table snapshot header")
+	}
+	name := string(payload[:nameLen])
+	payload = payload[nameLen:]
+	version := binary.LittleEndian.Uint16(payload)
+	payload = payload[2:]
+	instructionSeqNum := binary.LittleEndian.Uint32(payload)
+	payload = payload[4:]
+	finalized := payload[0] != 0
+
+	return name, version, instructionSeqNum, finalized, nil
+}
+
+// encodeSnapshotDictionary encodes the dictionary section: dictToString
+// entries in ascending index order, so a reader can memory-map the section
+// and binary search it without first sorting.
+func (sym *SymTable) encodeSnapshotDictionary() []byte {
+	indices := make([]uint64, 0, len(sym.dictToString))
+	for index := range sym.dictToString {
+		indices = append(indices, index)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+
+	size := 4
+	for _, index := range indices {
+		size += 8 + 2 + len(sym.dictToString[index])
+	}
+
+	buf := make([]byte, size)
+	ndx := 0
+	binary.LittleEndian.PutUint32(buf[ndx:], uint32(len(indices)))
+	ndx += 4
+	for _, index := range indices {
+		binary.LittleEndian.PutUint64(buf[ndx:], index)
+		ndx += 8
+		value := sym.dictToString[index]
+		binary.LittleEndian.PutUint16(buf[ndx:], uint16(len(value)))
+		ndx += 2
+		copy(buf[ndx:], value)
+		ndx += len(value)
+	}
+
+	return buf
+}
+
+// decodeSnapshotDictionary is the inverse of encodeSnapshotDictionary. It
+// also folds every restored value into sym.contentHash in the same ascending
+// index order it was written, so ContentHash is reproducible across a
+// snapshot round-trip even though it won't match the source table's hash if
+// the source interleaved dictionary and attribute inserts in a different
+// order.
+func (sym *SymTable) decodeSnapshotDictionary(payload []byte) error {
+	if len(payload) < 4 {
+		return errors.New("invalid symbol table snapshot dictionary section")
+	}
+	count := binary.LittleEndian.Uint32(payload)
+	payload = payload[4:]
+
+	for i := uint32(0); i < count; i++ {
+		if len(payload) < 8+2 {
+			return errors.New("invalid symbol table snapshot dictionary section")
+		}
+		index := binary.LittleEndian.Uint64(payload)
+		payload = payload[8:]
+		valueLen := binary.LittleEndian.Uint16(payload)
+		payload = payload[2:]
+		if len(payload) < int(valueLen) {
+			return errors.New("invalid symbol table snapshot dictionary section")
+		}
+		value := string(payload[:valueLen])
+		payload = payload[valueLen:]
+
+		sym.dictToString[index] = value
+		sym.dictToIndex[value] = index
+		sym.contentHash = foldHashString(sym.contentHash, value)
+	}
+
+	return nil
+}
+
+// encodeSnapshotColumns encodes the header (column name -> column index)
+// section, in name order for a reproducible snapshot.
+func (sym *SymTable) encodeSnapshotColumns() []byte {
+	names := make([]string, 0, len(sym.header))
+	for name := range sym.header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	size := 4
+	for _, name := range names {
+		size += 2 + len(name) + 4
+	}
+
+	buf := make([]byte, size)
+	ndx := 0
+	binary.LittleEndian.PutUint32(buf[ndx:], uint32(len(names)))
+	ndx += 4
+	for _, name := range names {
+		binary.LittleEndian.PutUint16(buf[ndx:], uint16(len(name)))
+		ndx += 2
+		copy(buf[ndx:], name)
+		ndx += len(name)
+		binary.LittleEndian.PutUint32(buf[ndx:], uint32(sym.header[name]))
+		ndx += 4
+	}
+
+	return buf
+}
+
+// decodeSnapshotColumns is the inverse of encodeSnapshotColumns.
+func (sym *SymTable) decodeSnapshotColumns(payload []byte) error {
+	if len(payload) < 4 {
+		return errors.New("invalid symbol table snapshot columns section")
+	}
+	count := binary.LittleEndian.Uint32(payload)
+	payload = payload[4:]
+
+	for i := uint32(0); i < count; i++ {
+		if len(payload) < 2 {
+			return errors.New("invalid symbol table snapshot columns section")
+		}
+		nameLen := binary.LittleEndian.Uint16(payload)
+		payload = payload[2:]
+		if len(payload) < int(nameLen)+4 {
+			return errors.New("invalid symbol table snapshot columns section")
+		}
+		name := string(payload[:nameLen])
+		payload = payload[nameLen:]
+		colIndex := binary.LittleEndian.Uint32(payload)
+		payload = payload[4:]
+
+		sym.header[name] = int(colIndex)
+	}
+
+	return nil
+}
+
+// encodeSnapshotAttributeTable encodes one framed block for at. A
+// DictionaryEncodedValue (or Roaring) attribute's encodedValues are bit
+// packed to the minimum width that can represent any dictionary index, since
+// those columns are usually low-cardinality relative to the dictionary; a
+// UnsignedNumericValue attribute's numericValues are written as a flat array
+// of uint64s, matching the wire codec's non-Roaring layout, since they carry
+// no dictionary index to bound their width.
+//
+// A tombstoned entry (see DeleteAttributeValue) can't be packed as-is: it's
+// c_TombstoneSentinel, far outside the range bitWidthForDictSize sizes the
+// packing for. Instead, the in-band value len(sym.dictToString) - one past
+// every real dictionary index - stands in for it, and bitWidth is widened by
+// one value (via bitWidthForDictSize(dictSize+1)) only for an attribute that
+// actually has at least one tombstone, so the common tombstone-free case
+// packs exactly as before.
+func (sym *SymTable) encodeSnapshotAttributeTable(at *AttributeTable) []byte {
+	head := make([]byte, 2+len(at.name)+2+8+4)
+	ndx := 0
+	binary.LittleEndian.PutUint16(head[ndx:], uint16(len(at.name)))
+	ndx += 2
+	copy(head[ndx:], at.name)
+	ndx += len(at.name)
+	binary.LittleEndian.PutUint16(head[ndx:], uint16(at.encodingType))
+	ndx += 2
+	binary.LittleEndian.PutUint64(head[ndx:], at.valueOffset)
+	ndx += 8
+
+	if at.encodingType == UnsignedNumericValue {
+		binary.LittleEndian.PutUint32(head[ndx:], uint32(len(at.numericValues)))
+		body := make([]byte, 8*len(at.numericValues))
+		for i, v := range at.numericValues {
+			binary.LittleEndian.PutUint64(body[i*8:], v)
+		}
+		return append(head, body...)
+	}
+
+	binary.LittleEndian.PutUint32(head[ndx:], uint32(len(at.encodedValues)))
+
+	dictSize := len(sym.dictToString)
+	hasTombstone := false
+	for _, v := range at.encodedValues {
+		if v == c_TombstoneSentinel {
+			hasTombstone = true
+			break
+		}
+	}
+
+	packableDictSize := dictSize
+	if hasTombstone {
+		packableDictSize++
+	}
+	bitWidth := bitWidthForDictSize(packableDictSize)
+
+	values := at.encodedValues
+	if hasTombstone {
+		values = make([]uint64, len(at.encodedValues))
+		for i, v := range at.encodedValues {
+			if v == c_TombstoneSentinel {
+				v = uint64(dictSize)
+			}
+			values[i] = v
+		}
+	}
+
+	body := append([]byte{byte(bitWidth)}, packBits(values, bitWidth)...)
+	return append(head, body...)
+}
+
+// decodeSnapshotAttributeTable is the inverse of encodeSnapshotAttributeTable,
+// folding every restored value into sym.contentHash for the same reason
+// decodeSnapshotDictionary does.
+func (sym *SymTable) decodeSnapshotAttributeTable(payload []byte) error {
+	if len(payload) < 2 {
+		return errors.New("invalid symbol table snapshot attribute block")
+	}
+	nameLen := binary.LittleEndian.Uint16(payload)
+	payload = payload[2:]
+	if len(payload) < int(nameLen)+2+8+4 {
+		return errors.New("invalid symbol table snapshot attribute block")
+	}
+	name := string(payload[:nameLen])
+	payload = payload[nameLen:]
+	encodingType := AttributeEncoding(binary.LittleEndian.Uint16(payload))
+	payload = payload[2:]
+	valueOffset := binary.LittleEndian.Uint64(payload)
+	payload = payload[8:]
+	count := binary.LittleEndian.Uint32(payload)
+	payload = payload[4:]
+
+	at := newAttributeTable(name, encodingType, nil, false)
+	at.valueOffset = valueOffset
+
+	if encodingType == UnsignedNumericValue {
+		if len(payload) < 8*int(count) {
+			return errors.New("invalid symbol table snapshot attribute block")
+		}
+		for i := uint32(0); i < count; i++ {
+			v := binary.LittleEndian.Uint64(payload)
+			payload = payload[8:]
+			at.numericValues = append(at.numericValues, v)
+			at.numericValuesFromIndex[v] = valueOffset + uint64(i)
+			sym.contentHash = foldHashString(sym.contentHash, name)
+			sym.contentHash = foldHashUint64(sym.contentHash, v)
+		}
+	} else {
+		if len(payload) < 1 {
+			return errors.New("invalid symbol table snapshot attribute block")
+		}
+		bitWidth := int(payload[0])
+		payload = payload[1:]
+		packedLen := (bitWidth*int(count) + 7) / 8
+		if len(payload) < packedLen {
+			return errors.New("invalid symbol table snapshot attribute block")
+		}
+		dictSize := uint64(len(sym.dictToString))
+		for i, v := range unpackBits(payload[:packedLen], bitWidth, int(count)) {
+			if v == dictSize {
+				v = c_TombstoneSentinel
+				at.encodedValues = append(at.encodedValues, v)
+				continue
+			}
+			at.encodedValues = append(at.encodedValues, v)
+			at.encodedValuesFromIndex[v] = valueOffset + uint64(i)
+			sym.contentHash = foldHashString(sym.contentHash, name)
+			sym.contentHash = foldHashUint64(sym.contentHash, v)
+		}
+	}
+
+	sym.attributeTable[name] = at
+	return nil
+}
+
+// bitWidthForDictSize returns the number of bits needed to represent any
+// index in [0, dictSize), i.e. ceil(log2(dictSize)), with a floor of 1 bit so
+// a dictionary of size 0 or 1 still packs into a well-formed (if wasteful)
+// block.
+func bitWidthForDictSize(dictSize int) int {
+	if dictSize <= 1 {
+		return 1
+	}
+	return bits.Len(uint(dictSize - 1))
+}
+
+// packBits packs values into a bitWidth-bit-per-value little-endian bit
+// stream.
+func packBits(values []uint64, bitWidth int) []byte {
+	buf := make([]byte, (bitWidth*len(values)+7)/8)
+	bitPos := 0
+	for _, v := range values {
+		for b := 0; b < bitWidth; b++ {
+			if v&(1<<uint(b)) != 0 {
+				buf[bitPos/8] |= 1 << uint(bitPos%8)
+			}
+			bitPos++
+		}
+	}
+	return buf
+}
+
+// unpackBits is the inverse of packBits.
+func unpackBits(buf []byte, bitWidth int, count int) []uint64 {
+	values := make([]uint64, count)
+	bitPos := 0
+	for i := 0; i < count; i++ {
+		var v uint64
+		for b := 0; b < bitWidth; b++ {
+			if buf[bitPos/8]&(1<<uint(bitPos%8)) != 0 {
+				v |= 1 << uint(b)
+			}
+			bitPos++
+		}
+		values[i] = v
+	}
+	return values
+}